@@ -0,0 +1,323 @@
+// Package smthttp 以 HTTP/JSON 的形式远程提供 exercise.SparseMerkleTree 的读写和证明
+// 只依赖 exercise 包导出的接口
+package smthttp
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"gocourse/exercise"
+)
+
+// 请求的限制，防止单个请求占用过多内存或计算
+const (
+	maxBody      = 1 << 20 // 请求体的最大字节数
+	maxBatchKeys = 1024    // 一次写入或多键证明中键的最大数量
+)
+
+// errBadRequest 请求格式错误（键不是十六进制、请求体不是合法的 JSON 等）
+var errBadRequest = errors.New("bad request")
+
+// NewHandler 返回以 JSON 形式提供树的读写和证明的 http.Handler
+// 键和值在 URL 和 JSON 中都使用十六进制编码；证明使用 exercise.Proof 和 exercise.MultiProof 的 JSON 编码，
+// 客户端解码后可以用 exercise.VerifyProof、exercise.VerifyMultiProof 在本地验证
+// 接口:
+//   GET  /root                    当前根哈希、深度和哈希算法
+//                                 {"root","depth","hasher","version"}
+//   GET  /get?key=<hex>           查询键 {"root","entry":{"key","value","exists"}}
+//   GET  /proof?key=<hex>         键的存在性或不存在性证明 {"root","entry","proof"}
+//   GET  /multiproof?key=<hex>... 多个键的多键证明（key 参数可以重复）{"root","entries","proof"}
+//   POST /update                  批量写入 {"pairs":[{"key":"<hex>","value":"<hex>"}]}，返回 {"root"}；
+//                                 需要请求头 Authorization: Bearer <token>
+// 参数:
+//   tree: 要提供服务的树
+//   token: 写入时使用的共享令牌；为空时拒绝所有写入
+// 返回:
+//   http.Handler，可以用 http.StripPrefix 挂载到任意路径下
+// 注意:
+//   每个读请求的结果和证明都取自同一个根（见 exercise.SparseMerkleTree.View），
+//   响应头 ETag 为该根哈希，请求头 If-None-Match 与之相同时返回 304；
+//   所有错误都以 {"error": "..."} 的形式返回；500 错误的详细信息只记录到日志
+func NewHandler(tree *exercise.SparseMerkleTree, token string) http.Handler {
+	h := &handler{tree: tree, token: token, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/root", h.handleRoot)
+	h.mux.HandleFunc("/get", h.handleGet)
+	h.mux.HandleFunc("/proof", h.handleProof)
+	h.mux.HandleFunc("/multiproof", h.handleMultiProof)
+	h.mux.HandleFunc("/update", h.handleUpdate)
+	h.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such endpoint: %s", r.URL.Path))
+	})
+	return h
+}
+
+// handler NewHandler 返回的处理器
+type handler struct {
+	tree  *exercise.SparseMerkleTree
+	token string         // 写入时使用的共享令牌
+	mux   *http.ServeMux // 路由
+}
+
+// entry 响应中的一个键值对，值不存在时省略
+type entry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Exists bool   `json:"exists"`
+}
+
+// ServeHTTP 实现 http.Handler
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// handleRoot 处理 GET /root
+func (h *handler) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	view := h.tree.View()
+	writeResult(w, r, view.GetRoot(), map[string]any{
+		"root":    hex.EncodeToString(view.GetRoot()),
+		"depth":   h.tree.Depth(),
+		"hasher":  h.tree.Hasher().Name(),
+		"version": view.Version(),
+	})
+}
+
+// handleGet 处理 GET /get?key=<hex>
+func (h *handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	key, err := queryKey(r)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	view := h.tree.View()
+	value, found, err := view.Get(key)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeResult(w, r, view.GetRoot(), map[string]any{
+		"root":  hex.EncodeToString(view.GetRoot()),
+		"entry": newEntry(key, value, found),
+	})
+}
+
+// handleProof 处理 GET /proof?key=<hex>
+func (h *handler) handleProof(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	key, err := queryKey(r)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	view := h.tree.View()
+	value, found, err := view.Get(key)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	proof, err := view.GenerateProof(key)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeResult(w, r, view.GetRoot(), map[string]any{
+		"root":  hex.EncodeToString(view.GetRoot()),
+		"entry": newEntry(key, value, found),
+		"proof": proof,
+	})
+}
+
+// handleMultiProof 处理 GET /multiproof?key=<hex>&key=<hex>...
+func (h *handler) handleMultiProof(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	params := r.URL.Query()["key"]
+	if len(params) == 0 || len(params) > maxBatchKeys {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: need 1 to %d key parameters", errBadRequest, maxBatchKeys))
+		return
+	}
+	keys := make([][]byte, len(params))
+	for i, param := range params {
+		key, err := decodeHexParam("key", param)
+		if err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+		keys[i] = key
+	}
+	view := h.tree.View()
+	proof, entries, err := view.GenerateMultiProof(keys)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	out := make([]entry, len(entries))
+	for i, e := range entries {
+		out[i] = newEntry(e.Key, e.Value, e.Exists)
+	}
+	writeResult(w, r, view.GetRoot(), map[string]any{
+		"root":    hex.EncodeToString(view.GetRoot()),
+		"entries": out,
+		"proof":   proof,
+	})
+}
+
+// handleUpdate 处理 POST /update
+func (h *handler) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	if h.token == "" {
+		writeError(w, http.StatusForbidden, errors.New("updates are disabled"))
+		return
+	}
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(h.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="smt"`)
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+		return
+	}
+
+	var req struct {
+		Pairs []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"pairs"`
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %v", errBadRequest, err))
+		return
+	}
+	if len(req.Pairs) == 0 || len(req.Pairs) > maxBatchKeys {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: need 1 to %d pairs", errBadRequest, maxBatchKeys))
+		return
+	}
+	pairs := make([]exercise.KeyValue, len(req.Pairs))
+	for i, p := range req.Pairs {
+		key, err := decodeHexParam("key", p.Key)
+		if err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+		value, err := decodeHexParam("value", p.Value)
+		if err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+		pairs[i] = exercise.KeyValue{Key: key, Value: value}
+	}
+	if err := h.tree.UpdateBatch(pairs); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	// 并发写入时，这里的根可能已经包含了之后的写入
+	root := h.tree.GetRoot()
+	w.Header().Set("ETag", rootETag(root))
+	writeJSON(w, http.StatusOK, map[string]any{"root": hex.EncodeToString(root)})
+}
+
+// newEntry 构造响应中的键值对
+func newEntry(key, value []byte, exists bool) entry {
+	e := entry{Key: hex.EncodeToString(key), Exists: exists}
+	if exists {
+		e.Value = hex.EncodeToString(value)
+	}
+	return e
+}
+
+// allowMethod 检查请求方法，不允许时返回 405
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method || (method == http.MethodGet && r.Method == http.MethodHead) {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	return false
+}
+
+// queryKey 读取查询参数中的键
+func queryKey(r *http.Request) ([]byte, error) {
+	return decodeHexParam("key", r.URL.Query().Get("key"))
+}
+
+// decodeHexParam 解码十六进制参数，name 用于错误信息
+func decodeHexParam(name, s string) ([]byte, error) {
+	if s == "" && name == "key" {
+		return nil, fmt.Errorf("%w: missing %s", errBadRequest, name)
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s is not hex: %v", errBadRequest, name, err)
+	}
+	return b, nil
+}
+
+// rootETag 以根哈希作为 ETag
+func rootETag(root []byte) string {
+	return `"` + hex.EncodeToString(root) + `"`
+}
+
+// writeResult 写出读请求的结果，并处理基于根哈希的 ETag
+func writeResult(w http.ResponseWriter, r *http.Request, root []byte, body any) {
+	etag := rootETag(root)
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == etag || candidate == "*" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// writeJSON 以 JSON 写出响应
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError 以 {"error": "..."} 的形式写出错误
+// 服务器内部错误（例如节点存储读写失败）可能包含文件路径等内部信息，
+// 只记录到日志，响应中使用通用的错误信息
+func writeError(w http.ResponseWriter, status int, err error) {
+	msg := err.Error()
+	if status >= http.StatusInternalServerError {
+		log.Printf("smthttp: %v", err)
+		msg = "internal error"
+	}
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// statusOf 把错误映射为 HTTP 状态码
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, errBadRequest), errors.Is(err, exercise.ErrInvalidKeyLength):
+		return http.StatusBadRequest
+	case errors.Is(err, exercise.ErrKeyCollision):
+		return http.StatusConflict
+	case errors.Is(err, exercise.ErrInvalidAmount), errors.Is(err, exercise.ErrSumOverflow):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
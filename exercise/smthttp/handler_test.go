@@ -0,0 +1,357 @@
+package smthttp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"gocourse/exercise"
+)
+
+// newTestTree 返回包含 alice、bob 两个键的树
+func newTestTree(t *testing.T) *exercise.SparseMerkleTree {
+	t.Helper()
+	tree := exercise.NewSparseMerkleTree(256)
+	err := tree.UpdateBatch([]exercise.KeyValue{
+		{Key: []byte("alice"), Value: []byte("100")},
+		{Key: []byte("bob"), Value: []byte("200")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// serve 直接调用处理器，token 不为空时带上 Authorization 请求头
+func serve(h http.Handler, method, target, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// checkError 检查响应的状态码，以及响应体是否为 {"error": "..."}
+func checkError(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status: got %d, want %d (%s)", rec.Code, status, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type: got %q", ct)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body is not JSON: %v (%s)", err, rec.Body)
+	}
+	if len(body) != 1 || body["error"] == "" {
+		t.Errorf("error body: got %v, want a single non-empty \"error\"", body)
+	}
+}
+
+// updateBody 构造 POST /update 的请求体
+func updateBody(key, value string) string {
+	return `{"pairs":[{"key":"` + hex.EncodeToString([]byte(key)) + `","value":"` + hex.EncodeToString([]byte(value)) + `"}]}`
+}
+
+func TestUpdateAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string // 处理器配置的令牌
+		sent   string // 请求中带的令牌
+		status int
+	}{
+		{"updates disabled", "", "anything", http.StatusForbidden},
+		{"missing token", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "guess", http.StatusUnauthorized},
+		{"valid token", "s3cret", "s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestTree(t)
+			before := tree.GetRoot()
+			rec := serve(NewHandler(tree, tt.token), http.MethodPost, "/update", tt.sent, updateBody("carol", "300"))
+			value, found, _ := tree.Get([]byte("carol"))
+			if tt.status != http.StatusOK {
+				checkError(t, rec, tt.status)
+				if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+					t.Error("401 without WWW-Authenticate")
+				}
+				if found || !bytes.Equal(tree.GetRoot(), before) {
+					t.Error("rejected update modified the tree")
+				}
+				return
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status: got %d (%s)", rec.Code, rec.Body)
+			}
+			if !found || string(value) != "300" {
+				t.Errorf("carol: got %q (found=%v)", value, found)
+			}
+			var resp struct{ Root string }
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			if resp.Root != hex.EncodeToString(tree.GetRoot()) {
+				t.Errorf("root: got %s, want %x", resp.Root, tree.GetRoot())
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	h := NewHandler(newTestTree(t), "s3cret")
+	tests := []struct {
+		method, target, allow string
+	}{
+		{http.MethodPost, "/root", http.MethodGet},
+		{http.MethodDelete, "/get?key=00", http.MethodGet},
+		{http.MethodPut, "/multiproof?key=00", http.MethodGet},
+		{http.MethodGet, "/update", http.MethodPost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.target, "s3cret", "")
+			checkError(t, rec, http.StatusMethodNotAllowed)
+			if got := rec.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow: got %q, want %q", got, tt.allow)
+			}
+		})
+	}
+}
+
+func TestBadRequest(t *testing.T) {
+	h := NewHandler(newTestTree(t), "s3cret")
+	tests := []struct {
+		name, method, target, body string
+		status                     int
+	}{
+		{"key not hex", http.MethodGet, "/get?key=zz", "", http.StatusBadRequest},
+		{"odd length key", http.MethodGet, "/proof?key=abc", "", http.StatusBadRequest},
+		{"missing key", http.MethodGet, "/get", "", http.StatusBadRequest},
+		{"multiproof without keys", http.MethodGet, "/multiproof", "", http.StatusBadRequest},
+		{"multiproof key not hex", http.MethodGet, "/multiproof?key=00&key=xyz", "", http.StatusBadRequest},
+		{"body not JSON", http.MethodPost, "/update", "{", http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/update", `{"pairs":[],"extra":1}`, http.StatusBadRequest},
+		{"no pairs", http.MethodPost, "/update", `{"pairs":[]}`, http.StatusBadRequest},
+		{"value not hex", http.MethodPost, "/update", `{"pairs":[{"key":"00","value":"zz"}]}`, http.StatusBadRequest},
+		{"unknown endpoint", http.MethodGet, "/nope", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkError(t, serve(h, tt.method, tt.target, "s3cret", tt.body), tt.status)
+		})
+	}
+}
+
+func TestETag(t *testing.T) {
+	tree := newTestTree(t)
+	h := NewHandler(tree, "s3cret")
+	rec := serve(h, http.MethodGet, "/root", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d (%s)", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Root   string
+		Depth  int
+		Hasher string
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Root != hex.EncodeToString(tree.GetRoot()) || resp.Depth != 256 || resp.Hasher != "sha256" {
+		t.Errorf("root: got %+v", resp)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag != `"`+resp.Root+`"` {
+		t.Fatalf("ETag: got %q, want the quoted root", etag)
+	}
+
+	// conditional 带 If-None-Match 请求 target
+	conditional := func(target, match string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("If-None-Match", match)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	for _, match := range []string{etag, `"other", ` + etag, "*"} {
+		rec := conditional("/get?key="+hex.EncodeToString([]byte("alice")), match)
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: got %d with %d body bytes, want 304 without body", match, rec.Code, rec.Body.Len())
+		}
+	}
+
+	if rec := serve(h, http.MethodPost, "/update", "s3cret", updateBody("alice", "90")); rec.Code != http.StatusOK {
+		t.Fatalf("update: got %d (%s)", rec.Code, rec.Body)
+	}
+	rec = conditional("/root", etag)
+	if rec.Code != http.StatusOK {
+		t.Errorf("stale ETag: got %d, want 200", rec.Code)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Error("ETag did not change after an update")
+	}
+}
+
+func TestProofVerifiesOnClient(t *testing.T) {
+	tree := newTestTree(t)
+	h := NewHandler(tree, "")
+
+	for _, key := range []string{"alice", "nobody"} {
+		rec := serve(h, http.MethodGet, "/proof?key="+hex.EncodeToString([]byte(key)), "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d (%s)", key, rec.Code, rec.Body)
+		}
+		var resp struct {
+			Root  string
+			Entry struct {
+				Key, Value string
+				Exists     bool
+			}
+			Proof *exercise.Proof
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		root, _ := hex.DecodeString(resp.Root)
+		value, _ := hex.DecodeString(resp.Entry.Value)
+		var ok bool
+		if resp.Entry.Exists {
+			ok = exercise.VerifyProof(root, []byte(key), value, resp.Proof)
+		} else {
+			ok = exercise.VerifyNonInclusionProof(root, []byte(key), resp.Proof)
+		}
+		if !ok || !bytes.Equal(root, tree.GetRoot()) {
+			t.Errorf("%s: proof does not verify against the tree root (exists=%v)", key, resp.Entry.Exists)
+		}
+	}
+}
+
+func TestMultiProofVerifiesOnClient(t *testing.T) {
+	tree := newTestTree(t)
+	h := NewHandler(tree, "")
+	keys := []string{"alice", "bob", "nobody"}
+	target := "/multiproof?"
+	for i, key := range keys {
+		if i > 0 {
+			target += "&"
+		}
+		target += "key=" + hex.EncodeToString([]byte(key))
+	}
+	rec := serve(h, http.MethodGet, target, "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d (%s)", rec.Code, rec.Body)
+	}
+
+	// 客户端只依赖响应内容：解码键值和证明，用响应中的根验证
+	var resp struct {
+		Root    string
+		Entries []struct {
+			Key, Value string
+			Exists     bool
+		}
+		Proof *exercise.MultiProof
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Entries) != len(keys) {
+		t.Fatalf("entries: got %d, want %d", len(resp.Entries), len(keys))
+	}
+	root, err := hex.DecodeString(resp.Root)
+	if err != nil || !bytes.Equal(root, tree.GetRoot()) {
+		t.Fatalf("root: got %s, want %x", resp.Root, tree.GetRoot())
+	}
+	entries := make([]exercise.ProofEntry, len(resp.Entries))
+	for i, e := range resp.Entries {
+		key, err := hex.DecodeString(e.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := hex.DecodeString(e.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[i] = exercise.ProofEntry{Key: key, Value: value, Exists: e.Exists}
+	}
+	want := []struct {
+		value  string
+		exists bool
+	}{{"100", true}, {"200", true}, {"", false}}
+	for i, w := range want {
+		if string(entries[i].Key) != keys[i] || string(entries[i].Value) != w.value || entries[i].Exists != w.exists {
+			t.Errorf("entry %d: got %q=%q (exists=%v)", i, entries[i].Key, entries[i].Value, entries[i].Exists)
+		}
+	}
+	if !exercise.VerifyMultiProof(root, entries, resp.Proof) {
+		t.Fatal("multiproof does not verify")
+	}
+
+	// 篡改任意一个值或存在性，验证都必须失败
+	entries[0].Value = []byte("101")
+	if exercise.VerifyMultiProof(root, entries, resp.Proof) {
+		t.Error("multiproof verifies a tampered value")
+	}
+	entries[0].Value = []byte("100")
+	entries[2].Exists, entries[2].Value = true, []byte("0")
+	if exercise.VerifyMultiProof(root, entries, resp.Proof) {
+		t.Error("multiproof verifies a forged entry")
+	}
+}
+
+// failingStore 读写总是失败的节点存储
+type failingStore struct{}
+
+func (failingStore) Get([]byte) ([]byte, error) {
+	return nil, errors.New("read /var/lib/smt/nodes.db: input/output error")
+}
+
+func (failingStore) Put([]byte, []byte) error {
+	return errors.New("write /var/lib/smt/nodes.db: no space left on device")
+}
+
+// TestInternalError 内部错误只记录到日志，响应中不包含错误的详细信息
+func TestInternalError(t *testing.T) {
+	committed := exercise.NewSparseMerkleTree(256, exercise.WithNodeStore(exercise.NewMemoryNodeStore()))
+	if err := committed.Update([]byte("alice"), []byte("100")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := committed.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	tree := exercise.NewSparseMerkleTree(256, exercise.WithNodeStore(failingStore{}), exercise.WithRoot(committed.GetRoot()))
+	h := NewHandler(tree, "s3cret")
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name, method, target, body string
+	}{
+		{"get", http.MethodGet, "/get?key=" + hex.EncodeToString([]byte("alice")), ""},
+		{"proof", http.MethodGet, "/proof?key=" + hex.EncodeToString([]byte("alice")), ""},
+		{"update", http.MethodPost, "/update", updateBody("bob", "200")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logged.Reset()
+			rec := serve(h, tt.method, tt.target, "s3cret", tt.body)
+			checkError(t, rec, http.StatusInternalServerError)
+			if strings.Contains(rec.Body.String(), "nodes.db") {
+				t.Errorf("response leaks the error: %s", rec.Body)
+			}
+			if !strings.Contains(logged.String(), "nodes.db") {
+				t.Errorf("error not logged: %q", logged.String())
+			}
+		})
+	}
+}
@@ -1,29 +1,132 @@
 package exercise
 
 import (
-	"crypto/sha256"
+	"bytes"
+	"cmp"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"sync"
 )
 
+// ErrKeyCollision 键冲突错误
+// 当树的深度小于键哈希的比特数时（例如 depth=8），两个不同的键可能共享前 depth 个比特位，
+// 从而落到同一个叶子槽位。Update 不会静默覆盖已有的键，而是返回该错误
+var ErrKeyCollision = errors.New("smt: key collides with an existing key at the leaf level")
+
 // SparseMerkleTree 稀疏默克尔树
 // 稀疏默克尔树是一种优化的默克尔树，专门用于处理大量可能的键值对，但实际只存储少量数据的场景
 // 与传统默克尔树不同，稀疏默克尔树不需要为所有可能的叶子节点分配内存
-// 它通过使用默认的"空节点"来表示未使用的位置，从而节省大量空间
+// 空子树用 nil 隐式表示，它的哈希直接取自预计算的每一高度的默认哈希表，从而节省大量空间
+// 树是持久化（写时复制）的：修改只会创建新节点，已有节点一旦创建就不再改变，
+// 因此历史版本与当前版本可以共享所有未改变的子树
+// 树可以被多个 goroutine 同时使用：任意多个读操作可以与一个写操作并发执行，
+// 每个读操作看到的都是某一时刻完整的树（见 currentRoot），多个写操作之间互相排斥
 type SparseMerkleTree struct {
-	root  *Node // 树的根节点
-	depth int   // 树的深度，决定了树可以容纳的最大键数量 (2^depth)
+	treeConfig                    // 树的配置（哈希算法等），在创建时确定
+	root       *Node              // 树的根节点（nil 表示空树）
+	depth      int                // 树的深度，决定了树可以容纳的最大键数量 (2^depth)
+	defaults   [][]byte           // defaults[h] 是高度为 h 的空子树哈希（叶子层高度为 0，根节点高度为 depth）
+	versions   []committedVersion // 保留的已提交版本，按版本号升序（见 Commit 和 PruneVersions）
+	latest     Version            // 最近一次提交的版本号
+	journal    *Journal           // 预写日志（见 OpenSparseMerkleTree），nil 表示不记录日志
+
+	// mu 保护 root、versions、latest 和 journal
+	// 写操作在整个过程中持有写锁；读操作只在取得根节点时短暂持有读锁，
+	// 之后在这个根上无锁地进行（节点一旦创建就不再改变，见 currentRoot）
+	mu sync.RWMutex
+}
+
+// treeConfig 树的配置
+// 树和无状态验证函数共享同一份配置，保证两边使用相同的哈希规则
+type treeConfig struct {
+	hasher   Hasher // 哈希算法，默认为 SHA-256
+	legacy   bool   // 是否使用旧的无前缀哈希布局（见 WithLegacyHashing）
+	shortcut bool   // 是否使用捷径叶子的存储模式（见 WithShortcutLeaves）
+	workers  int    // 批量更新的最大并发度（见 WithBatchWorkers）
+	sum      bool   // 是否为求和树，每个哈希后附带子树的总额（见 WithSums）
+	raw      bool   // 是否直接用键本身作为路径（见 WithRawKeys）
+
+	// 以下几项只对树本身有效，验证函数会忽略它们
+	store      NodeStore // 节点存储（见 WithNodeStore），nil 表示所有节点只保存在内存中
+	openRoot   []byte    // 要打开的已有根哈希（见 WithRoot）
+	stagingDir string    // ReadSnapshot 暂存存储所在的目录（见 WithStagingDir），空表示 os.TempDir()
+}
+
+// Option 配置选项
+// 用于 NewSparseMerkleTree 以及无状态的验证函数，例如 WithHasher(SHA3_256Hasher)
+type Option func(*treeConfig)
+
+// WithHasher 指定树使用的哈希算法
+// 参数:
+//   hasher: 哈希算法，例如 SHA256Hasher、SHA512_256Hasher、SHA3_256Hasher
+func WithHasher(hasher Hasher) Option {
+	return func(c *treeConfig) {
+		c.hasher = hasher
+	}
+}
+
+// WithLegacyHashing 使用旧的哈希布局
+// 旧布局中叶子哈希为 H(value)，内部节点哈希为 H(left || right)，既没有前缀也不绑定键
+// 仅用于复现旧版本生成的根哈希，新建的树应使用默认的域分离布局
+// 注意:
+//   叶子的键只通过它在完整深度树中的位置约束，树的深度小于键哈希的比特数时（例如 depth=8），
+//   无法证明占用某个槽位的叶子不是被查询的键，因此这样的树中路径终点是其他键的叶子的
+//   不存在性证明一律被拒绝（多键证明、区间证明同理，见 bindsLeafKey）；
+//   不能与 WithNodeStore 一起使用（见 ErrLegacyNodeStore）
+func WithLegacyHashing() Option {
+	return func(c *treeConfig) {
+		c.legacy = true
+	}
+}
+
+// WithShortcutLeaves 使用捷径叶子的存储模式
+// 类似 Diem 的 Jellyfish 树和 Celestia 的 SMT：子树中只有一个键时，该键直接存为这棵子树的根，
+// 即叶子存放在它能保持唯一的最浅一层，而不是在 depth=256 时物化出 256 个内部节点
+// 捷径叶子的哈希等于它在完整深度树中所在子树的哈希，因此两种模式的根哈希完全相同，
+// 证明也可以在捷径叶子处结束，省略下面全部为默认哈希的兄弟节点
+func WithShortcutLeaves() Option {
+	return func(c *treeConfig) {
+		c.shortcut = true
+	}
+}
+
+// newTreeConfig 根据选项构造配置，未指定的项使用默认值
+func newTreeConfig(opts []Option) treeConfig {
+	c := treeConfig{
+		hasher:  SHA256Hasher,
+		workers: defaultWorkers(),
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.sum {
+		c.legacy = false // 求和树总是使用域分离布局
+	}
+	return c
 }
 
 // Node 树节点
-// 在稀疏默克尔树中，节点可以是内部节点或叶子节点
+// 在稀疏默克尔树中，节点可以是内部节点或叶子节点（key 不为 nil）
 // 内部节点包含左右子节点的引用，叶子节点包含实际的键值对
+// 默认模式下叶子只出现在叶子层；捷径模式下叶子可以出现在任意一层
 type Node struct {
-	hash  []byte // 节点的哈希值，对于内部节点是左右子节点哈希的组合，对于叶子节点是值的哈希
+	hash  []byte // 节点的哈希值，对于内部节点是左右子节点哈希的组合，对于叶子节点是它所在子树的哈希
 	left  *Node  // 左子节点指针
 	right *Node  // 右子节点指针
 	key   []byte // 叶子节点的键（已哈希），用于在到达叶子节点时验证是否找到了正确的键
 	value []byte // 叶子节点的值（原始数据）
+
+	lazy   bool // 只有哈希、尚未从存储中加载的占位节点（见 load）
+	stored bool // 节点已经写入存储，它的整棵子树也都已写入
+}
+
+// clone 复制节点，用于写时复制
+// 节点可能被多个版本共享，修改前必须先复制，原节点保持不变
+func (n *Node) clone() *Node {
+	c := *n
+	c.stored = false // 复制出的节点是新节点，需要在下一次 Commit 时写入存储
+	return &c
 }
 
 // NewSparseMerkleTree 创建新的稀疏默克尔树
@@ -31,35 +134,105 @@ type Node struct {
 //   depth: 树的深度，支持 2^depth 个叶子节点
 //          例如: depth=8 可以支持 256 个不同的键
 //          depth=256 可以支持 2^256 个键（接近无限）
+//   opts: 可选配置，例如 WithHasher(SHA512_256Hasher)；默认使用 SHA-256
+//         使用 WithNodeStore 和 WithRoot 可以打开存储中已有的树
 // 返回:
-//   初始化的稀疏默克尔树实例，初始根节点为空节点
-func NewSparseMerkleTree(depth int) *SparseMerkleTree {
-	return &SparseMerkleTree{
-		root:  newEmptyNode(),
-		depth: depth,
+//   初始化的稀疏默克尔树实例，没有指定 WithRoot 时为空树
+// 注意:
+//   同时指定 WithLegacyHashing 和 WithNodeStore 是调用者的编程错误，会 panic（见 ErrLegacyNodeStore）；
+//   OpenSparseMerkleTree 和 ReadSnapshot 在这种情况下返回错误
+func NewSparseMerkleTree(depth int, opts ...Option) *SparseMerkleTree {
+	smt := &SparseMerkleTree{
+		treeConfig: newTreeConfig(opts),
+		depth:      depth,
 	}
+	if err := smt.checkStore(); err != nil {
+		panic(err)
+	}
+	smt.defaults = smt.defaultHashes(depth)
+	if smt.openRoot != nil && !bytes.Equal(smt.openRoot, smt.defaults[depth]) {
+		smt.root = stubNode(smt.openRoot) // 已有的根，节点在访问时才从存储加载
+	}
+	return smt
 }
 
-// newEmptyNode 创建空节点
-// 空节点代表树中未被使用的位置
-// 所有空节点具有相同的哈希值（空字节数组的SHA256哈希）
-// 这是稀疏默克尔树的关键优化：不需要为每个空位置创建新对象
-func newEmptyNode() *Node {
-	emptyHash := sha256.Sum256([]byte{})
-	return &Node{
-		hash: emptyHash[:],
+// defaultHashes 预计算每一高度的空子树哈希
+// 空子树代表树中未被使用的位置，同一高度的所有空子树具有相同的哈希值:
+//   empty[0] = H("")（空叶子）
+//   empty[h] = H(empty[h-1] || empty[h-1])
+// 这是稀疏默克尔树的关键优化：只需计算 depth+1 个哈希，不需要为每个空位置创建对象
+// 旧布局下所有高度都使用 H("")，以复现旧版本的根哈希
+// 参数:
+//   height: 需要计算到的最大高度（通常为树的深度）
+// 返回:
+//   长度为 height+1 的默认哈希表
+func (c *treeConfig) defaultHashes(height int) [][]byte {
+	defaults := make([][]byte, height+1)
+	defaults[0] = c.hasher.Hash()
+	if c.sum {
+		defaults[0] = appendSum(defaults[0], 0) // 空子树的总额为 0
 	}
+	for h := 1; h <= height; h++ {
+		if c.legacy {
+			defaults[h] = defaults[0]
+		} else {
+			defaults[h] = c.hashNodes(defaults[h-1], defaults[h-1])
+		}
+	}
+	return defaults
+}
+
+// hashOf 获取第 depth 层子树的哈希
+// 空子树（nil）直接返回预计算的默认哈希，无需分配节点
+func (smt *SparseMerkleTree) hashOf(node *Node, depth int) []byte {
+	if node == nil {
+		return smt.defaults[smt.depth-depth]
+	}
+	return node.hash
 }
 
 // hashData 对数据进行哈希
-// 使用 SHA256 算法对输入数据进行哈希
+// 使用配置的哈希算法对输入数据进行哈希（用于键；值使用 hashValue）
 // 参数:
 //   data: 待哈希的字节数据
 // 返回:
-//   32字节的哈希值
-func hashData(data []byte) []byte {
-	hash := sha256.Sum256(data)
-	return hash[:]
+//   哈希值（长度由哈希算法决定，标准库提供的算法均为32字节）
+func (c *treeConfig) hashData(data []byte) []byte {
+	return c.hasher.Hash(data)
+}
+
+// 域分离前缀
+// 叶子哈希和内部节点哈希使用不同的前缀，使得一个精心构造的 64 字节值无法冒充内部节点（第二原像攻击）
+var (
+	leafPrefix = []byte{0x00} // 叶子节点哈希前缀
+	nodePrefix = []byte{0x01} // 内部节点哈希前缀
+)
+
+// hashLeaf 计算叶子节点的哈希
+// 叶子哈希同时绑定键哈希和值哈希，因此同一个值放在不同的键下会得到不同的叶子哈希
+// 参数:
+//   keyHash: 键的哈希值
+//   valueHash: 值的哈希值
+// 返回:
+//   叶子哈希 H(0x00 || keyHash || valueHash)；旧布局下直接返回 valueHash；
+//   求和树中为 H(0x00 || keyHash || valueHash) || 金额（见 sumLeaf）
+func (c *treeConfig) hashLeaf(keyHash, valueHash []byte) []byte {
+	if c.sum {
+		return c.sumLeaf(keyHash, valueHash)
+	}
+	if c.legacy {
+		return valueHash
+	}
+	return c.hasher.Hash(leafPrefix, keyHash, valueHash)
+}
+
+// bindsLeafKey 判断深度为 depth 的树的根哈希是否约束了叶子的完整键哈希
+// 默认布局的叶子哈希包含键哈希；旧布局的叶子哈希只有 H(value)，键哈希只通过叶子在完整深度树中的位置约束，
+// 深度小于键哈希的比特数时，超出深度的比特位不受约束：伪造者可以把被查询的键自己的叶子
+// 说成是同一槽位中另一个键的叶子，从而"证明"一个存在的键不存在
+// 验证者遇到键与被证明的键不同的叶子时，必须先用它确认该叶子的键可信
+func (c *treeConfig) bindsLeafKey(depth int, keyHash []byte) bool {
+	return !c.legacy || depth >= len(keyHash)*8
 }
 
 // hashNodes 合并两个节点的哈希
@@ -68,10 +241,56 @@ func hashData(data []byte) []byte {
 //   left: 左子节点的哈希值
 //   right: 右子节点的哈希值
 // 返回:
-//   合并后的哈希值 (Hash(left || right))
-func hashNodes(left, right []byte) []byte {
-	combined := append(left, right...)
-	return hashData(combined)
+//   合并后的哈希值 H(0x01 || left || right)；旧布局下为 H(left || right)；
+//   求和树中为 H(0x01 || left || right) || 两侧总额之和（见 sumNodes）
+func (c *treeConfig) hashNodes(left, right []byte) []byte {
+	if c.sum {
+		return c.sumNodes(left, right)
+	}
+	if c.legacy {
+		return c.hasher.Hash(left, right)
+	}
+	return c.hasher.Hash(nodePrefix, left, right)
+}
+
+// foldLeaf 计算只包含一个叶子的子树哈希
+// 在完整深度的树中，该叶子位于叶子层，它与第 depth 层之间的所有兄弟都是空子树，
+// 因此可以从叶子哈希开始，沿着键哈希的比特位逐层与默认哈希合并
+// 参数:
+//   keyHash: 叶子的键哈希（决定每一层的左右方向）
+//   leafHash: 叶子哈希
+//   depth: 子树根所在的层
+//   treeDepth: 树的深度
+//   defaults: 默认哈希表，至少包含到高度 treeDepth-depth
+// 返回:
+//   子树的哈希；当 depth == treeDepth 时就是叶子哈希本身
+func (c *treeConfig) foldLeaf(keyHash, leafHash []byte, depth, treeDepth int, defaults [][]byte) []byte {
+	h := leafHash
+	for level := treeDepth - 1; level >= depth; level-- {
+		sibling := defaults[treeDepth-level-1]
+		if getBit(keyHash, level) {
+			h = c.hashNodes(sibling, h)
+		} else {
+			h = c.hashNodes(h, sibling)
+		}
+	}
+	return h
+}
+
+// newLeaf 创建位于第 depth 层的叶子节点
+// 默认模式下 depth 总是叶子层；捷径模式下叶子的哈希是它在完整深度树中所在子树的哈希
+func (smt *SparseMerkleTree) newLeaf(keyHash, value, leafHash []byte, depth int) *Node {
+	return &Node{
+		hash:  smt.foldLeaf(keyHash, leafHash, depth, smt.depth, smt.defaults),
+		key:   keyHash,  // 存储键的哈希用于后续验证
+		value: value,    // 存储原始值
+	}
+}
+
+// moveLeaf 把已有的叶子移动到第 depth 层（捷径模式下叶子下沉或上提时使用）
+func (smt *SparseMerkleTree) moveLeaf(leaf *Node, depth int) *Node {
+	leafHash := smt.hashLeaf(leaf.key, smt.hashValue(leaf.value))
+	return smt.newLeaf(leaf.key, leaf.value, leafHash, depth)
 }
 
 // getBit 获取字节数组在指定位置的比特位
@@ -92,20 +311,76 @@ func getBit(data []byte, position int) bool {
 	return (data[byteIndex]>>bitIndex)&1 == 1  // 提取指定位置的比特位
 }
 
+// commonPrefix 计算两个键哈希共同前缀的比特数（最多比较 limit 位）
+func commonPrefix(a, b []byte, limit int) int {
+	for i := 0; i < limit; i++ {
+		if getBit(a, i) != getBit(b, i) {
+			return i
+		}
+	}
+	return limit
+}
+
 // Update 更新或插入键值对
 // 这是稀疏默克尔树的核心操作，支持插入新键或更新现有键的值
 // 参数:
 //   key: 原始键（任意字节数组）
 //   value: 要存储的值（任意字节数组）
+// 返回:
+//   如果该键与树中已有的另一个键落在同一个叶子槽位，返回 ErrKeyCollision，树保持不变；
+//   使用节点存储时，加载节点失败也会返回错误；使用预写日志时，写入日志失败也会返回错误；
+//   求和树中值不带金额时返回 ErrInvalidAmount，总额溢出时返回 ErrSumOverflow（见 WithSums）
 // 工作流程:
 //   1. 对键进行哈希，得到固定长度的键哈希（用于确定路径）
-//   2. 对值进行哈希，得到叶子节点的哈希值
-//   3. 从根节点开始，递归更新树结构
-//   4. 更新路径上所有节点的哈希值
-func (smt *SparseMerkleTree) Update(key, value []byte) {
-	keyHash := hashData(key)
-	valueHash := hashData(value)
-	smt.root = smt.update(smt.root, keyHash, value, valueHash, 0)
+//   2. 检查该键的叶子槽位是否已被其他键占用
+//   3. 对值进行哈希，并与键哈希一起计算出叶子节点的哈希值
+//   4. 从根节点开始，递归更新树结构
+//   5. 更新路径上所有节点的哈希值
+//   6. 使用预写日志时，先把这次写入追加到日志，再让新的根生效
+func (smt *SparseMerkleTree) Update(key, value []byte) error {
+	smt.mu.Lock()
+	defer smt.mu.Unlock()
+	if err := smt.checkKey(key, smt.depth); err != nil {
+		return err
+	}
+	if err := smt.checkAmount(value); err != nil {
+		return err
+	}
+	keyHash := smt.hashKey(key)
+	leaf, err := smt.findLeaf(keyHash)
+	if err != nil {
+		return err
+	}
+	if leaf != nil && !bytes.Equal(leaf.key, keyHash) && commonPrefix(leaf.key, keyHash, smt.depth) == smt.depth {
+		return ErrKeyCollision
+	}
+	leafHash := smt.hashLeaf(keyHash, smt.hashValue(value))
+	root, err := smt.update(smt.root, keyHash, value, leafHash, 0)
+	if err != nil {
+		return err
+	}
+	if err := smt.checkSum(root); err != nil {
+		return err
+	}
+	if err := smt.journal.logUpdate(key, value); err != nil {
+		return err
+	}
+	smt.root = root
+	return nil
+}
+
+// findLeaf 沿键哈希的路径向下查找，返回路径终点的叶子
+// 返回的叶子可能属于其他键（需要调用者比较 key），路径终点是空子树时返回 nil
+func (smt *SparseMerkleTree) findLeaf(keyHash []byte) (*Node, error) {
+	node, err := smt.load(smt.root, 0)
+	for depth := 0; err == nil && node != nil && node.key == nil; depth++ {
+		if getBit(keyHash, depth) {
+			node, err = smt.load(node.right, depth+1)
+		} else {
+			node, err = smt.load(node.left, depth+1)
+		}
+	}
+	return node, err
 }
 
 // update 递归更新节点
@@ -114,27 +389,50 @@ func (smt *SparseMerkleTree) Update(key, value []byte) {
 //   node: 当前处理的节点
 //   keyHash: 键的哈希值（用于确定路径）
 //   value: 原始值（存储在叶子节点）
-//   valueHash: 值的哈希（存储在叶子节点的hash字段）
+//   leafHash: 叶子哈希（存储在叶子节点的hash字段）
 //   depth: 当前深度（0表示根节点）
 // 返回:
-//   更新后的节点（可能是新创建的节点）
+//   更新后的节点（可能是新创建的节点）；加载节点失败时返回错误
 // 工作原理:
 //   - 如果到达叶子层(depth == smt.depth)，创建新的叶子节点
+//   - 捷径模式下，遇到空子树就直接在这一层创建叶子；遇到其他键的捷径叶子，
+//     则把它下沉一层，直到两个键的路径分叉
 //   - 否则，根据keyHash的当前比特位决定向左或向右递归
 //   - 递归返回后，重新计算当前节点的哈希值
-func (smt *SparseMerkleTree) update(node *Node, keyHash, value, valueHash []byte, depth int) *Node {
+//   - 路径之外的空子树保持为 nil，不会分配任何节点
+//   - 路径上的已有节点不会被修改，而是复制出新节点，路径之外的子树与旧版本共享
+func (smt *SparseMerkleTree) update(node *Node, keyHash, value, leafHash []byte, depth int) (*Node, error) {
 	// 到达叶子节点层，创建新的叶子节点存储键值对
 	if depth == smt.depth {
-		return &Node{
-			hash:  valueHash,  // 叶子节点的哈希是值的哈希
-			key:   keyHash,    // 存储键的哈希用于后续验证
-			value: value,      // 存储原始值
-		}
+		return smt.newLeaf(keyHash, value, leafHash, depth), nil
 	}
 
-	// 如果当前节点为空（第一次访问该路径），创建新的空节点
+	node, err := smt.load(node, depth)
+	if err != nil {
+		return nil, err
+	}
 	if node == nil {
-		node = newEmptyNode()
+		// 捷径模式：这棵子树中只有这一个键，叶子直接放在这一层
+		if smt.shortcut {
+			return smt.newLeaf(keyHash, value, leafHash, depth), nil
+		}
+		// 第一次访问该路径，创建新的内部节点
+		node = &Node{}
+	} else if node.key != nil {
+		// 捷径叶子：同一个键直接替换，否则把原来的叶子下沉一层，变成新内部节点的子节点
+		if bytes.Equal(node.key, keyHash) {
+			return smt.newLeaf(keyHash, value, leafHash, depth), nil
+		}
+		old := node
+		node = &Node{}
+		if getBit(old.key, depth) {
+			node.right = smt.moveLeaf(old, depth+1)
+		} else {
+			node.left = smt.moveLeaf(old, depth+1)
+		}
+	} else {
+		// 写时复制：已有的内部节点可能被历史版本引用，复制后再修改
+		node = node.clone()
 	}
 
 	// 根据 keyHash 的第 depth 个比特位决定往左还是右
@@ -142,33 +440,117 @@ func (smt *SparseMerkleTree) update(node *Node, keyHash, value, valueHash []byte
 	bit := getBit(keyHash, depth)
 
 	if bit { // bit = 1，往右子树递归
-		if node.right == nil {
-			node.right = newEmptyNode()
-		}
-		node.right = smt.update(node.right, keyHash, value, valueHash, depth+1)
+		node.right, err = smt.update(node.right, keyHash, value, leafHash, depth+1)
 	} else { // bit = 0，往左子树递归
-		if node.left == nil {
-			node.left = newEmptyNode()
-		}
-		node.left = smt.update(node.left, keyHash, value, valueHash, depth+1)
+		node.left, err = smt.update(node.left, keyHash, value, leafHash, depth+1)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	// 更新当前节点的哈希值
-	// 父节点的哈希 = Hash(左子节点哈希 || 右子节点哈希)
-	var leftHash, rightHash []byte
-	if node.left == nil {
-		leftHash = newEmptyNode().hash  // 如果左子节点不存在，使用空节点的哈希
+	// 父节点的哈希 = Hash(左子节点哈希 || 右子节点哈希)，不存在的子节点使用对应高度的默认哈希
+	node.hash = smt.hashNodes(smt.hashOf(node.left, depth+1), smt.hashOf(node.right, depth+1))
+
+	return node, nil
+}
+
+// Delete 删除键
+// 从稀疏默克尔树中移除指定的键，并回收路径上变为空的内部节点
+// 参数:
+//   key: 要删除的键（原始字节数组）
+// 返回:
+//   true 表示该键存在并已删除，false 表示该键不存在（树保持不变）
+//   使用节点存储时，加载节点失败会返回错误；使用预写日志时，写入日志失败也会返回错误；出错时树保持不变
+// 注意:
+//   删除与"写入空值"不同：写入空值会留下一个哈希为 hashData(nil) 的叶子，
+//   而删除后树的根哈希与从未插入过该键的树完全一致
+func (smt *SparseMerkleTree) Delete(key []byte) (bool, error) {
+	smt.mu.Lock()
+	defer smt.mu.Unlock()
+	if err := smt.checkKey(key, smt.depth); err != nil {
+		return false, err
+	}
+	keyHash := smt.hashKey(key)
+	root, deleted, err := smt.delete(smt.root, keyHash, 0)
+	if err != nil || !deleted {
+		return false, err
+	}
+	if err := smt.journal.logDelete(key); err != nil {
+		return false, err
+	}
+	smt.root = root // 树被删空时 root 为 nil，与新建的空树一致
+	return true, nil
+}
+
+// delete 递归删除节点
+// 这是 Delete 方法的内部递归实现
+// 参数:
+//   node: 当前处理的节点
+//   keyHash: 键的哈希值（用于确定路径）
+//   depth: 当前深度
+// 返回:
+//   删除后的节点（nil 表示该子树已经为空，父节点应视其为空节点）
+//   deleted: 是否找到并删除了该键
+//   err: 加载节点失败时的错误
+// 工作原理:
+//   - 到达叶子时，只有键哈希匹配才删除该叶子
+//   - 递归返回后，如果左右子节点都为空，说明 update 在这条路径上创建的内部节点已无用，将其剪除
+//   - 捷径模式下，如果只剩下一个叶子子节点，把它上提到当前层，保持叶子在最浅的唯一位置
+//   - 否则重新计算当前节点的哈希值
+func (smt *SparseMerkleTree) delete(node *Node, keyHash []byte, depth int) (*Node, bool, error) {
+	node, err := smt.load(node, depth)
+	if err != nil || node == nil {
+		return nil, false, err
+	}
+
+	if node.key != nil {
+		if bytes.Equal(node.key, keyHash) {
+			return nil, true, nil
+		}
+		return node, false, nil // 该位置存储的是其他键，保持不变
+	}
+
+	var child *Node
+	var deleted bool
+	bit := getBit(keyHash, depth)
+	if bit {
+		child, deleted, err = smt.delete(node.right, keyHash, depth+1)
 	} else {
-		leftHash = node.left.hash
+		child, deleted, err = smt.delete(node.left, keyHash, depth+1)
 	}
-	if node.right == nil {
-		rightHash = newEmptyNode().hash  // 如果右子节点不存在，使用空节点的哈希
+	if err != nil || !deleted {
+		return node, false, err
+	}
+
+	// 写时复制：不修改可能被历史版本引用的原节点
+	node = node.clone()
+	if bit {
+		node.right = child
 	} else {
-		rightHash = node.right.hash
+		node.left = child
 	}
-	node.hash = hashNodes(leftHash, rightHash)
 
-	return node
+	// 子树已经为空，剪除当前内部节点
+	if node.left == nil && node.right == nil {
+		return nil, true, nil
+	}
+
+	// 捷径模式：子树中只剩一个键，用上提的叶子替换当前内部节点
+	// 剩下的子节点可能还没有加载，需要加载后才能判断它是不是叶子
+	if smt.shortcut && (node.left == nil || node.right == nil) {
+		only, err := smt.load(cmp.Or(node.left, node.right), depth+1)
+		if err != nil {
+			return nil, false, err
+		}
+		if only.key != nil {
+			return smt.moveLeaf(only, depth), true, nil
+		}
+	}
+
+	node.hash = smt.hashNodes(smt.hashOf(node.left, depth+1), smt.hashOf(node.right, depth+1))
+
+	return node, true, nil
 }
 
 // Get 获取键对应的值
@@ -178,9 +560,13 @@ func (smt *SparseMerkleTree) update(node *Node, keyHash, value, valueHash []byte
 // 返回:
 //   value: 键对应的值（如果存在）
 //   found: 布尔值，表示是否找到该键
-func (smt *SparseMerkleTree) Get(key []byte) ([]byte, bool) {
-	keyHash := hashData(key)
-	return smt.get(smt.root, keyHash, 0)
+//   err: 使用节点存储时，加载节点失败的错误
+func (smt *SparseMerkleTree) Get(key []byte) ([]byte, bool, error) {
+	if err := smt.checkKey(key, smt.depth); err != nil {
+		return nil, false, err
+	}
+	keyHash := smt.hashKey(key)
+	return smt.get(smt.currentRoot(), keyHash, 0)
 }
 
 // get 递归获取值
@@ -192,22 +578,29 @@ func (smt *SparseMerkleTree) Get(key []byte) ([]byte, bool) {
 // 返回:
 //   value: 找到的值
 //   found: 是否找到
+//   err: 加载节点失败时的错误
 // 工作原理:
-//   按照与 Update 相同的路径规则向下遍历，直到到达叶子节点
+//   按照与 Update 相同的路径规则向下遍历，直到到达叶子节点（捷径模式下可能在任意一层）
 //   在叶子节点处验证键是否匹配
-func (smt *SparseMerkleTree) get(node *Node, keyHash []byte, depth int) ([]byte, bool) {
+func (smt *SparseMerkleTree) get(node *Node, keyHash []byte, depth int) ([]byte, bool, error) {
+	// 使用节点存储时，节点可能还没有加载
+	node, err := smt.load(node, depth)
+	if err != nil {
+		return nil, false, err
+	}
+
 	// 如果节点为空，说明该键不存在
 	if node == nil {
-		return nil, false
+		return nil, false, nil
 	}
 
-	// 到达叶子节点层，检查键是否匹配
-	if depth == smt.depth {
+	// 到达叶子节点，检查键是否匹配
+	if node.key != nil {
 		// 比较存储的键哈希与查询的键哈希
 		if string(node.key) == string(keyHash) {
-			return node.value, true  // 键匹配，返回值
+			return node.value, true, nil  // 键匹配，返回值
 		}
-		return nil, false  // 键不匹配，该位置存储的是其他键
+		return nil, false, nil  // 键不匹配，该位置存储的是其他键
 	}
 
 	// 根据 keyHash 的第 depth 个比特位决定往左还是右
@@ -219,30 +612,51 @@ func (smt *SparseMerkleTree) get(node *Node, keyHash []byte, depth int) ([]byte,
 }
 
 // Proof Merkle 证明
-// Merkle 证明是一个紧凑的数据结构，用于证明某个键值对存在于树中
+// Merkle 证明是一个紧凑的数据结构，用于证明某个键值对存在（或不存在）于树中
 // 无需提供整棵树，只需提供从叶子节点到根节点路径上的"兄弟节点"
 // 验证者可以使用这些兄弟节点重新计算根哈希，如果与已知的根哈希匹配，则证明有效
+// 不存在性证明有两种情况:
+//   1. 路径终点是空子树：LeafKey 为 nil，从该高度的默认哈希开始重建根哈希
+//   2. 路径终点被其他键占用：LeafKey/LeafValueHash 记录该叶子，验证者重新计算叶子哈希并确认它的键哈希与查询的不同
+// 由于 Update 拒绝冲突的键，浅深度的树中与已有键共享前 depth 个比特位的键，
+// 总是可以用情况2证明其不存在；但旧布局（WithLegacyHashing）下这种情况不被接受，见 bindsLeafKey
+// 捷径模式下路径在捷径叶子处结束，叶子下方全部为默认哈希的兄弟节点不会出现在证明中，
+// 验证者用 foldLeaf 自行补齐，因此同一份验证逻辑同时适用于两种存储模式
+// 路径上为空子树的兄弟节点同样只记录为 nil，验证者用对应高度的默认哈希代替，
+// 序列化时这些兄弟节点只占位图中的一个比特（见 MarshalBinary）
 type Proof struct {
-	Siblings [][]byte // 从叶子到根路径上所有兄弟节点的哈希值（按从根到叶的顺序）
-	Path     []bool   // 路径信息（false=该层向左，true=该层向右）
+	Siblings      [][]byte // 从叶子到根路径上所有兄弟节点的哈希值（按从根到叶的顺序），nil 表示该兄弟是空子树
+	Path          []bool   // 路径信息（false=该层向左，true=该层向右）
+	Exists        bool     // true 表示存在性证明，false 表示不存在性证明
+	LeafKey       []byte   // 不存在性证明中，占用该槽位的其他叶子的键哈希（空槽时为 nil）
+	LeafValueHash []byte   // 不存在性证明中，占用该槽位的其他叶子的值哈希（空槽时为 nil）
+	Depth         int      // 生成证明的树的深度，用于确定空子树的高度
 }
 
 // GenerateProof 生成 Merkle 证明
-// 为指定的键生成一个证明，证明该键值对存在于树中
+// 为指定的键生成一个证明，证明该键值对存在于树中，或者证明该键不存在
 // 参数:
 //   key: 要生成证明的键
 // 返回:
-//   包含兄弟节点哈希和路径信息的 Proof 结构
+//   包含兄弟节点哈希和路径信息的 Proof 结构，Exists 字段表示证明的类型
+//   使用节点存储时，加载节点失败会返回错误
 // 工作原理:
 //   沿着键对应的路径向下遍历，记录每一层的兄弟节点哈希
-func (smt *SparseMerkleTree) GenerateProof(key []byte) *Proof {
-	keyHash := hashData(key)
+//   如果路径终点是该键的叶子，生成存在性证明；否则生成不存在性证明
+func (smt *SparseMerkleTree) GenerateProof(key []byte) (*Proof, error) {
+	if err := smt.checkKey(key, smt.depth); err != nil {
+		return nil, err
+	}
+	keyHash := smt.hashKey(key)
 	proof := &Proof{
 		Siblings: make([][]byte, 0, smt.depth),  // 预分配容量以提高效率
 		Path:     make([]bool, 0, smt.depth),
+		Depth:    smt.depth,
+	}
+	if err := smt.generateProof(smt.currentRoot(), keyHash, 0, proof); err != nil {
+		return nil, err
 	}
-	smt.generateProof(smt.root, keyHash, 0, proof)
-	return proof
+	return proof, nil
 }
 
 // generateProof 递归生成证明
@@ -252,87 +666,252 @@ func (smt *SparseMerkleTree) GenerateProof(key []byte) *Proof {
 //   keyHash: 键的哈希值
 //   depth: 当前深度
 //   proof: 正在构建的证明对象（通过指针修改）
+// 返回:
+//   加载节点失败时的错误
 // 工作原理:
 //   在每一层，记录兄弟节点的哈希和当前的路径方向
 //   如果向左走，记录右兄弟；如果向右走，记录左兄弟
-func (smt *SparseMerkleTree) generateProof(node *Node, keyHash []byte, depth int, proof *Proof) {
-	// 到达叶子节点层或遇到空节点，停止递归
-	if depth == smt.depth || node == nil {
-		return
+func (smt *SparseMerkleTree) generateProof(node *Node, keyHash []byte, depth int, proof *Proof) error {
+	node, err := smt.load(node, depth)
+	if err != nil {
+		return err
+	}
+
+	// 遇到空子树（包括空树的根节点），该键不存在，停止递归
+	if node == nil {
+		return nil
+	}
+
+	// 到达叶子节点，根据键哈希判断是存在性证明还是不存在性证明
+	if node.key != nil {
+		if bytes.Equal(node.key, keyHash) {
+			proof.Exists = true
+		} else {
+			proof.LeafKey = node.key   // 该槽位被其他键占用
+			proof.LeafValueHash = smt.hashValue(node.value)
+		}
+		return nil
 	}
 
 	bit := getBit(keyHash, depth)
 	proof.Path = append(proof.Path, bit)  // 记录路径方向
 
+	// 如果兄弟节点不存在，记录为 nil，验证者会使用对应高度的默认哈希
 	if bit { // 往右走，记录左兄弟节点的哈希
-		if node.left != nil {
-			proof.Siblings = append(proof.Siblings, node.left.hash)
-		} else {
-			// 如果左兄弟不存在，使用空节点的哈希
-			proof.Siblings = append(proof.Siblings, newEmptyNode().hash)
-		}
-		smt.generateProof(node.right, keyHash, depth+1, proof)
-	} else { // 往左走，记录右兄弟节点的哈希
-		if node.right != nil {
-			proof.Siblings = append(proof.Siblings, node.right.hash)
-		} else {
-			// 如果右兄弟不存在，使用空节点的哈希
-			proof.Siblings = append(proof.Siblings, newEmptyNode().hash)
-		}
-		smt.generateProof(node.left, keyHash, depth+1, proof)
+		proof.Siblings = append(proof.Siblings, siblingHash(node.left))
+		return smt.generateProof(node.right, keyHash, depth+1, proof)
 	}
+	// 往左走，记录右兄弟节点的哈希
+	proof.Siblings = append(proof.Siblings, siblingHash(node.right))
+	return smt.generateProof(node.left, keyHash, depth+1, proof)
+}
+
+// siblingHash 返回证明中记录的兄弟节点哈希，空子树记录为 nil
+func siblingHash(node *Node) []byte {
+	if node == nil {
+		return nil
+	}
+	return node.hash
 }
 
 // VerifyProof 验证 Merkle 证明
-// 验证给定的键值对是否存在于树中，无需访问整棵树
+// 验证给定的键值对是否存在于当前树中
+// 这是包级函数 VerifyProof 的便捷封装：使用树的当前根哈希，并额外检查证明的深度与树的深度一致
 // 参数:
 //   key: 要验证的键
 //   value: 要验证的值
 //   proof: 之前生成的 Merkle 证明
 // 返回:
 //   true 表示证明有效（键值对存在于树中），false 表示证明无效
-// 工作原理:
-//   1. 从叶子节点的值哈希开始
-//   2. 使用证明中的兄弟节点哈希，逐层向上计算父节点哈希
-//   3. 最终得到计算出的根哈希
-//   4. 将计算出的根哈希与树的实际根哈希比较
-// 注意：这个验证过程是从叶子向根进行的，所以需要从 Siblings 数组的末尾开始遍历
 func (smt *SparseMerkleTree) VerifyProof(key, value []byte, proof *Proof) bool {
-	valueHash := hashData(value)
+	if proof == nil || proof.Depth != smt.depth {
+		return false
+	}
+	return smt.verifyProof(smt.GetRoot(), key, value, proof)
+}
+
+// VerifyProof 无状态地验证 Merkle 证明
+// 验证者只需要持有一个 32 字节的根哈希，无需访问整棵树
+// 参数:
+//   root: 验证者信任的根哈希
+//   key: 要验证的键
+//   value: 要验证的值
+//   proof: 由 GenerateProof 生成的存在性证明
+//   opts: 生成证明的树所使用的配置（例如 WithHasher），必须与树一致
+// 返回:
+//   true 表示证明有效（键值对存在于 root 对应的树中），false 表示证明无效
+// 工作原理:
+//   1. 检查证明的路径与 hashData(key) 的比特位一致，防止把一个键的证明用在另一个值相同的键上
+//   2. 从键哈希和值哈希计算出的叶子哈希开始；如果路径在叶子层之前结束（捷径叶子），
+//      先用默认哈希补齐到路径终点所在的层
+//   3. 使用证明中的兄弟节点哈希，逐层向上计算父节点哈希
+//   4. 将计算出的根哈希与给定的根哈希比较
+func VerifyProof(root, key, value []byte, proof *Proof, opts ...Option) bool {
+	c := newTreeConfig(opts)
+	return c.verifyProof(root, key, value, proof)
+}
+
+// verifyProof 使用给定配置验证存在性证明，是 VerifyProof 的内部实现
+func (c *treeConfig) verifyProof(root, key, value []byte, proof *Proof) bool {
+	if proof == nil || !c.validProofShape(proof) || c.checkKey(key, proof.Depth) != nil {
+		return false
+	}
+	keyHash := c.hashKey(key)
+	if !matchPath(keyHash, proof.Path) {
+		return false
+	}
+	defaults := c.defaultHashes(proof.Depth)
+	leafHash := c.hashLeaf(keyHash, c.hashValue(value))
+	leafHash = c.foldLeaf(keyHash, leafHash, len(proof.Path), proof.Depth, defaults)
+	return bytes.Equal(c.rootFromProof(leafHash, proof, defaults), root)
+}
 
-	// 从叶子节点的值哈希开始
-	currentHash := valueHash
+// VerifyNonInclusionProof 验证不存在性证明
+// 验证给定的键不存在于当前树中
+// 这是包级函数 VerifyNonInclusionProof 的便捷封装，额外检查证明的深度与树的深度一致
+// 参数:
+//   key: 要验证不存在的键
+//   proof: 由 GenerateProof 生成的不存在性证明（Exists 为 false）
+// 返回:
+//   true 表示证明有效（该键确实不在树中），false 表示证明无效
+func (smt *SparseMerkleTree) VerifyNonInclusionProof(key []byte, proof *Proof) bool {
+	if proof == nil || proof.Depth != smt.depth {
+		return false
+	}
+	return smt.verifyNonInclusionProof(smt.GetRoot(), key, proof)
+}
 
-	// 从底部往上计算，重建根哈希
-	// 遍历 Siblings 数组（从后往前，因为生成时是从上往下记录的）
+// VerifyNonInclusionProof 无状态地验证不存在性证明
+// 验证者只需要持有根哈希，即可确认某个键不在 root 对应的树中
+// 参数:
+//   root: 验证者信任的根哈希
+//   key: 要验证不存在的键
+//   proof: 由 GenerateProof 生成的不存在性证明（Exists 为 false）
+//   opts: 生成证明的树所使用的配置（例如 WithHasher），必须与树一致
+// 返回:
+//   true 表示证明有效（该键确实不在树中），false 表示证明无效
+// 工作原理:
+//   1. 检查证明路径与键哈希的比特位一致，确保证明针对的是该键的路径
+//   2. 如果路径终点是空子树，从该高度的默认哈希开始；
+//      如果路径终点被其他键占用，确认该叶子的键哈希与查询的键哈希不同且位于同一路径上，
+//      再由该叶子的键哈希和值哈希重新计算叶子哈希，并用默认哈希补齐到路径终点所在的层
+//      （旧布局下深度小于键哈希的比特数时，这种证明总是被拒绝，见 bindsLeafKey）
+//   3. 使用兄弟节点哈希逐层向上计算，最终与给定的根哈希比较
+func VerifyNonInclusionProof(root, key []byte, proof *Proof, opts ...Option) bool {
+	c := newTreeConfig(opts)
+	return c.verifyNonInclusionProof(root, key, proof)
+}
+
+// verifyNonInclusionProof 使用给定配置验证不存在性证明，是 VerifyNonInclusionProof 的内部实现
+func (c *treeConfig) verifyNonInclusionProof(root, key []byte, proof *Proof) bool {
+	if proof == nil || proof.Exists || !c.validProofShape(proof) || c.checkKey(key, proof.Depth) != nil {
+		return false
+	}
+
+	// 证明的路径必须就是该键的路径，否则可以拿任意空槽来"证明"不存在
+	keyHash := c.hashKey(key)
+	if !matchPath(keyHash, proof.Path) {
+		return false
+	}
+
+	defaults := c.defaultHashes(proof.Depth)
+
+	var leafHash []byte
+	if proof.LeafKey == nil {
+		// 情况1：路径终点是空子树，其高度为 Depth - len(Path)
+		leafHash = defaults[proof.Depth-len(proof.Path)]
+	} else {
+		// 情况2：路径终点被其他键占用，该叶子的键必须不同且处在同一路径上
+		if !c.bindsLeafKey(proof.Depth, keyHash) {
+			return false
+		}
+		if bytes.Equal(proof.LeafKey, keyHash) || !matchPath(proof.LeafKey, proof.Path) {
+			return false
+		}
+		leafHash = c.hashLeaf(proof.LeafKey, proof.LeafValueHash)
+		leafHash = c.foldLeaf(proof.LeafKey, leafHash, len(proof.Path), proof.Depth, defaults)
+	}
+
+	return bytes.Equal(c.rootFromProof(leafHash, proof, defaults), root)
+}
+
+// validProofShape 检查证明的基本结构
+// 兄弟节点数量必须与路径长度一致，路径不能超过证明声明的深度，
+// 深度也不能超过键哈希的比特数（同时避免恶意的超大深度导致大量计算）
+func (c *treeConfig) validProofShape(proof *Proof) bool {
+	return len(proof.Siblings) == len(proof.Path) &&
+		len(proof.Path) <= proof.Depth &&
+		c.validDepth(proof.Depth)
+}
+
+// matchPath 检查路径是否与键哈希的前 len(path) 个比特位一致
+func matchPath(keyHash []byte, path []bool) bool {
+	for i, bit := range path {
+		if bit != getBit(keyHash, i) {
+			return false
+		}
+	}
+	return true
+}
+
+// rootFromProof 根据证明重建根哈希
+// 参数:
+//   leafHash: 路径终点的哈希（叶子哈希或空子树的默认哈希）
+//   proof: Merkle 证明
+//   defaults: 默认哈希表，用于代替证明中为 nil 的兄弟节点
+// 返回:
+//   从路径终点逐层向上计算得到的根哈希
+// 注意：这个计算过程是从叶子向根进行的，所以需要从 Siblings 数组的末尾开始遍历
+func (c *treeConfig) rootFromProof(leafHash []byte, proof *Proof, defaults [][]byte) []byte {
+	currentHash := leafHash
 	for i := len(proof.Siblings) - 1; i >= 0; i-- {
 		sibling := proof.Siblings[i]  // 当前层的兄弟节点哈希
-		path := proof.Path[i]         // 当前层的路径方向
-
-		if path { // 当前节点在右边，兄弟节点在左边
-			currentHash = hashNodes(sibling, currentHash)  // Hash(左 || 右)
+		if sibling == nil {
+			sibling = defaults[proof.Depth-i-1]  // 第 i 层兄弟节点的高度为 Depth-i-1
+		}
+		if proof.Path[i] { // 当前节点在右边，兄弟节点在左边
+			currentHash = c.hashNodes(sibling, currentHash)  // Hash(左 || 右)
 		} else { // 当前节点在左边，兄弟节点在右边
-			currentHash = hashNodes(currentHash, sibling)  // Hash(左 || 右)
+			currentHash = c.hashNodes(currentHash, sibling)  // Hash(左 || 右)
 		}
 	}
-
-	// 比较计算出的根哈希与树的实际根哈希
-	// 如果匹配，说明该键值对确实存在于树中
-	return string(currentHash) == string(smt.root.hash)
+	return currentHash
 }
 
 // GetRoot 获取根节点哈希
 // 返回树的根哈希，可用于验证整棵树的完整性
 // 任何对树的修改都会导致根哈希的变化
+// 空树的根哈希为高度 depth 的默认哈希
 func (smt *SparseMerkleTree) GetRoot() []byte {
-	return smt.root.hash
+	return smt.hashOf(smt.currentRoot(), 0)
+}
+
+// Depth 返回树的深度
+func (smt *SparseMerkleTree) Depth() int {
+	return smt.depth
+}
+
+// Hasher 返回树使用的哈希算法
+func (smt *SparseMerkleTree) Hasher() Hasher {
+	return smt.hasher
+}
+
+// currentRoot 在读锁保护下取得当前的根节点
+// 写操作只会替换根节点，不会修改任何已有的节点，
+// 因此读操作取得根之后可以不持有锁地遍历，看到的始终是取得根那一刻的完整的树；
+// 写操作内部已经持有写锁，应直接使用 smt.root
+func (smt *SparseMerkleTree) currentRoot() *Node {
+	smt.mu.RLock()
+	defer smt.mu.RUnlock()
+	return smt.root
 }
 
 // PrintTree 打印树结构（用于调试）
 // 以层次结构的形式打印整棵树，便于理解树的结构
+// 需要完整的哈希、写入文件或生成图形时使用 WriteJSON 和 WriteDOT
 func (smt *SparseMerkleTree) PrintTree() {
 	fmt.Println("稀疏默克尔树结构:")
-	smt.printNode(smt.root, 0, "Root")
+	smt.printNode(smt.currentRoot(), 0, "Root")
 }
 
 func (smt *SparseMerkleTree) printNode(node *Node, depth int, prefix string) {
@@ -345,11 +924,17 @@ func (smt *SparseMerkleTree) printNode(node *Node, depth int, prefix string) {
 		indent += "  "
 	}
 
+	node, err := smt.load(node, depth)
+	if err != nil {
+		fmt.Printf("%s%s: <%v>\n", indent, prefix, err)
+		return
+	}
+
 	hashStr := hex.EncodeToString(node.hash[:8]) // 只显示前8字节
 	fmt.Printf("%s%s: %s...\n", indent, prefix, hashStr)
 
 	if node.key != nil {
-		fmt.Printf("%s  Key: %s\n", indent, hex.EncodeToString(node.key[:4]))
+		fmt.Printf("%s  Key: %s\n", indent, hex.EncodeToString(node.key[:min(4, len(node.key))]))
 		fmt.Printf("%s  Value: %s\n", indent, string(node.value))
 	}
 
@@ -362,66 +947,3 @@ func (smt *SparseMerkleTree) printNode(node *Node, depth int, prefix string) {
 		}
 	}
 }
-
-func main() {
-	// 创建深度为 8 的稀疏默克尔树
-	smt := NewSparseMerkleTree(8)
-
-	fmt.Println("=== 稀疏默克尔树示例 ===")
-
-	// 插入一些键值对
-	fmt.Println("1. 插入键值对:")
-	data := map[string]string{
-		"alice": "100",
-		"bob":   "200",
-		"carol": "300",
-	}
-
-	for key, value := range data {
-		smt.Update([]byte(key), []byte(value))
-		fmt.Printf("   插入: %s = %s\n", key, value)
-	}
-
-	// 显示根哈希
-	fmt.Printf("\n2. 根哈希: %s\n", hex.EncodeToString(smt.GetRoot()))
-
-	// 查询值
-	fmt.Println("\n3. 查询值:")
-	if value, found := smt.Get([]byte("alice")); found {
-		fmt.Printf("   alice = %s\n", string(value))
-	}
-	if value, found := smt.Get([]byte("bob")); found {
-		fmt.Printf("   bob = %s\n", string(value))
-	}
-	if _, found := smt.Get([]byte("dave")); !found {
-		fmt.Println("   dave 不存在")
-	}
-
-	// 生成证明
-	fmt.Println("\n4. 生成 Merkle 证明:")
-	proof := smt.GenerateProof([]byte("alice"))
-	fmt.Printf("   alice 的证明包含 %d 个兄弟节点\n", len(proof.Siblings))
-
-	// 验证证明
-	fmt.Println("\n5. 验证 Merkle 证明:")
-	valid := smt.VerifyProof([]byte("alice"), []byte("100"), proof)
-	fmt.Printf("   alice=100 的证明验证: %v\n", valid)
-
-	// 验证错误的值
-	invalid := smt.VerifyProof([]byte("alice"), []byte("999"), proof)
-	fmt.Printf("   alice=999 的证明验证: %v\n", invalid)
-
-	// 更新值
-	fmt.Println("\n6. 更新值:")
-	smt.Update([]byte("alice"), []byte("150"))
-	fmt.Println("   更新 alice = 150")
-	if value, found := smt.Get([]byte("alice")); found {
-		fmt.Printf("   新值: alice = %s\n", string(value))
-	}
-	fmt.Printf("   新根哈希: %s\n", hex.EncodeToString(smt.GetRoot()))
-
-	// 旧证明应该失效
-	fmt.Println("\n7. 旧证明验证:")
-	stillValid := smt.VerifyProof([]byte("alice"), []byte("100"), proof)
-	fmt.Printf("   旧证明(alice=100)验证: %v (应该为 false)\n", stillValid)
-}
@@ -0,0 +1,238 @@
+package exercise
+
+import (
+	"bytes"
+	"cmp"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// KeyValue 键值对，用于批量更新
+type KeyValue struct {
+	Key   []byte // 原始键
+	Value []byte // 值
+}
+
+// WithBatchWorkers 指定 UpdateBatch 最多同时使用的 goroutine 数量
+// 参数:
+//   workers: 并发度上限，小于 1 时按 1 处理（即完全串行）；默认为 runtime.GOMAXPROCS(0)
+func WithBatchWorkers(workers int) Option {
+	return func(c *treeConfig) {
+		c.workers = max(workers, 1)
+	}
+}
+
+// batchItem 批量更新中的一项（键已哈希）
+type batchItem struct {
+	keyHash  []byte // 键哈希
+	value    []byte // 原始值
+	leafHash []byte // 叶子哈希
+}
+
+// UpdateBatch 批量更新或插入键值对
+// 与依次调用 Update 得到的根哈希完全相同，但每个节点只重新计算一次哈希，
+// 并且互不相交的子树会在不同的 goroutine 中并行计算（并发度受 WithBatchWorkers 限制）
+// 参数:
+//   pairs: 要写入的键值对；同一个键出现多次时，与依次 Update 一样以最后一次为准
+// 返回:
+//   如果任意一个键会与树中或本批中的其他键发生冲突，返回 ErrKeyCollision，此时树保持不变；
+//   使用节点存储时，加载节点失败也会返回错误；求和树中的金额错误与 Update 相同；出错时树同样保持不变
+// 工作流程:
+//   1. 并行计算所有键哈希和叶子哈希
+//   2. 按键哈希排序并去重，检查冲突
+//   3. 从根节点开始递归，按比特位把有序的键分成左右两段，一次性构建或合并整棵子树
+func (smt *SparseMerkleTree) UpdateBatch(pairs []KeyValue) error {
+	smt.mu.Lock()
+	defer smt.mu.Unlock()
+	return smt.applyBatch(pairs)
+}
+
+// applyBatch 批量写入的内部实现，调用者必须持有写锁
+func (smt *SparseMerkleTree) applyBatch(pairs []KeyValue) error {
+	for _, p := range pairs {
+		if err := smt.checkKey(p.Key, smt.depth); err != nil {
+			return err
+		}
+	}
+	unique := sortBatch(smt.hashBatch(pairs))
+
+	// 先检查冲突再修改树，保证出错时树保持不变
+	for i, item := range unique {
+		if err := smt.checkAmount(item.value); err != nil {
+			return err
+		}
+		if i > 0 && commonPrefix(unique[i-1].keyHash, item.keyHash, smt.depth) == smt.depth {
+			return ErrKeyCollision
+		}
+		leaf, err := smt.findLeaf(item.keyHash)
+		if err != nil {
+			return err
+		}
+		if leaf != nil && !bytes.Equal(leaf.key, item.keyHash) &&
+			commonPrefix(leaf.key, item.keyHash, smt.depth) == smt.depth {
+			return ErrKeyCollision
+		}
+	}
+
+	if len(unique) == 0 {
+		return nil
+	}
+	sem := make(chan struct{}, smt.workers-1) // 除当前 goroutine 外最多再启动 workers-1 个
+	root, err := smt.updateBatch(smt.root, unique, 0, sem)
+	if err != nil {
+		return err
+	}
+	if err := smt.checkSum(root); err != nil {
+		return err
+	}
+	// 使用预写日志时按原始顺序记录每一次写入，重放时依次 Update 得到相同的根
+	for _, p := range pairs {
+		if err := smt.journal.logUpdate(p.Key, p.Value); err != nil {
+			return err
+		}
+	}
+	smt.root = root
+	return nil
+}
+
+// hashBatch 并行计算每个键值对的键哈希和叶子哈希
+func (smt *SparseMerkleTree) hashBatch(pairs []KeyValue) []batchItem {
+	items := make([]batchItem, len(pairs))
+	chunk := (len(pairs) + smt.workers - 1) / smt.workers
+	var wg sync.WaitGroup
+	for start := 0; start < len(pairs); start += chunk {
+		end := min(start+chunk, len(pairs))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				keyHash := smt.hashKey(pairs[i].Key)
+				items[i] = batchItem{
+					keyHash:  keyHash,
+					value:    pairs[i].Value,
+					leafHash: smt.hashLeaf(keyHash, smt.hashValue(pairs[i].Value)),
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return items
+}
+
+// sortBatch 按键哈希排序并去重
+// 稳定排序后，相同键的多次写入保持原有顺序，只保留最后一次
+func sortBatch(items []batchItem) []batchItem {
+	sort.SliceStable(items, func(i, j int) bool {
+		return bytes.Compare(items[i].keyHash, items[j].keyHash) < 0
+	})
+	unique := items[:0]
+	for _, item := range items {
+		if n := len(unique); n > 0 && bytes.Equal(unique[n-1].keyHash, item.keyHash) {
+			unique[n-1] = item
+			continue
+		}
+		unique = append(unique, item)
+	}
+	return unique
+}
+
+// updateBatch 递归地把一段有序的键写入子树
+// 参数:
+//   node: 当前处理的节点
+//   items: 落在该子树中的键（按键哈希排序、去重、非空）
+//   depth: 当前深度
+//   sem: 限制并发的信号量
+// 返回:
+//   更新后的节点；加载节点失败时返回错误
+// 工作原理:
+//   - 到达叶子层时只可能剩下一个键（冲突已提前排除），直接创建叶子
+//   - 捷径模式下，空子树中只有一个键时直接创建捷径叶子；
+//     遇到已有的捷径叶子时，把它当作一个待写入的键（除非本批覆盖了它），在当前层重新构建
+//   - 否则按比特位把键分成左右两段分别递归，两侧都有键且信号量有空位时，左侧交给新的 goroutine
+func (smt *SparseMerkleTree) updateBatch(node *Node, items []batchItem, depth int, sem chan struct{}) (*Node, error) {
+	if depth == smt.depth {
+		last := items[len(items)-1]
+		return smt.newLeaf(last.keyHash, last.value, last.leafHash, depth), nil
+	}
+
+	node, err := smt.load(node, depth)
+	if err != nil {
+		return nil, err
+	}
+	if node != nil && node.key != nil {
+		// 捷径叶子：把原来的叶子并入本批（本批中没有同一个键时）
+		items = mergeLeafIntoBatch(items, batchItem{
+			keyHash:  node.key,
+			value:    node.value,
+			leafHash: smt.hashLeaf(node.key, smt.hashValue(node.value)),
+		})
+		node = nil
+	}
+
+	if node == nil {
+		if smt.shortcut && len(items) == 1 {
+			return smt.newLeaf(items[0].keyHash, items[0].value, items[0].leafHash, depth), nil
+		}
+		node = &Node{}
+	} else {
+		node = node.clone() // 写时复制，见 update
+	}
+
+	split := sort.Search(len(items), func(i int) bool {
+		return getBit(items[i].keyHash, depth)
+	})
+	left, right := items[:split], items[split:]
+
+	var leftErr, rightErr error
+	switch {
+	case len(left) > 0 && len(right) > 0:
+		select {
+		case sem <- struct{}{}:
+			// 左右子树互不相交，可以并行计算
+			done := make(chan struct{})
+			go func() {
+				defer func() { <-sem }()
+				node.left, leftErr = smt.updateBatch(node.left, left, depth+1, sem)
+				close(done)
+			}()
+			node.right, rightErr = smt.updateBatch(node.right, right, depth+1, sem)
+			<-done
+		default:
+			node.left, leftErr = smt.updateBatch(node.left, left, depth+1, sem)
+			if leftErr == nil {
+				node.right, rightErr = smt.updateBatch(node.right, right, depth+1, sem)
+			}
+		}
+	case len(left) > 0:
+		node.left, leftErr = smt.updateBatch(node.left, left, depth+1, sem)
+	default:
+		node.right, rightErr = smt.updateBatch(node.right, right, depth+1, sem)
+	}
+	if err := cmp.Or(leftErr, rightErr); err != nil {
+		return nil, err
+	}
+
+	node.hash = smt.hashNodes(smt.hashOf(node.left, depth+1), smt.hashOf(node.right, depth+1))
+	return node, nil
+}
+
+// mergeLeafIntoBatch 把已有的叶子按顺序插入有序的批次中
+// 如果批次中已经有同一个键，本批的新值覆盖旧叶子，批次保持不变
+func mergeLeafIntoBatch(items []batchItem, leaf batchItem) []batchItem {
+	i := sort.Search(len(items), func(i int) bool {
+		return bytes.Compare(items[i].keyHash, leaf.keyHash) >= 0
+	})
+	if i < len(items) && bytes.Equal(items[i].keyHash, leaf.keyHash) {
+		return items
+	}
+	merged := make([]batchItem, 0, len(items)+1)
+	merged = append(merged, items[:i]...)
+	merged = append(merged, leaf)
+	return append(merged, items[i:]...)
+}
+
+// defaultWorkers 默认的批量更新并发度
+func defaultWorkers() int {
+	return runtime.GOMAXPROCS(0)
+}
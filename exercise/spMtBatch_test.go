@@ -0,0 +1,150 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// collidingKeys 返回在深度为 depth 的树中落在同一个叶子槽位的两个不同的键
+func collidingKeys(t *testing.T, depth int) ([]byte, []byte) {
+	t.Helper()
+	tree := NewSparseMerkleTree(depth)
+	seen := make(map[string][]byte)
+	for i := 0; i < 1<<16; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		slot := string(tree.hashKey(key)[:depth/8])
+		if other, ok := seen[slot]; ok {
+			return other, key
+		}
+		seen[slot] = key
+	}
+	t.Fatal("no colliding keys found")
+	return nil, nil
+}
+
+func TestUpdateBatchMatchesUpdate(t *testing.T) {
+	account := func(i int) []byte { return []byte(fmt.Sprintf("account%d", i)) }
+	modes := []struct {
+		name  string
+		depth int
+		opts  []Option
+		key   func(i int) []byte
+	}{
+		{"default", 256, nil, account},
+		{"shortcut", 256, []Option{WithShortcutLeaves()}, account},
+		{"serial", 256, []Option{WithShortcutLeaves(), WithBatchWorkers(1)}, account},
+		{"four workers", 256, []Option{WithShortcutLeaves(), WithBatchWorkers(4)}, account},
+		{"legacy", 256, []Option{WithLegacyHashing()}, account},
+		{"sha3", 256, []Option{WithHasher(SHA3_256Hasher), WithShortcutLeaves()}, account},
+		{"raw keys", 64, []Option{WithRawKeys(), WithShortcutLeaves()}, func(i int) []byte { return height(uint64(i)) }},
+	}
+	batches := []struct {
+		name  string
+		pairs func(key func(i int) []byte) []KeyValue
+	}{
+		{"empty", func(func(int) []byte) []KeyValue { return nil }},
+		{"new keys", func(key func(int) []byte) []KeyValue {
+			var pairs []KeyValue
+			for i := 100; i < 400; i++ {
+				pairs = append(pairs, KeyValue{Key: key(i), Value: []byte(fmt.Sprint(i))})
+			}
+			return pairs
+		}},
+		{"overwrite", func(key func(int) []byte) []KeyValue {
+			return []KeyValue{{Key: key(3), Value: []byte("x")}, {Key: key(50), Value: []byte("y")}}
+		}},
+		{"duplicates", func(key func(int) []byte) []KeyValue {
+			// 同一个键出现多次时以最后一次为准
+			return []KeyValue{
+				{Key: key(200), Value: []byte("first")},
+				{Key: key(7), Value: []byte("a")},
+				{Key: key(200), Value: []byte("last")},
+			}
+		}},
+	}
+	for _, m := range modes {
+		for _, b := range batches {
+			t.Run(m.name+"/"+b.name, func(t *testing.T) {
+				sequential := NewSparseMerkleTree(m.depth, m.opts...)
+				batched := NewSparseMerkleTree(m.depth, m.opts...)
+				for i := 0; i < 100; i++ {
+					for _, tree := range []*SparseMerkleTree{sequential, batched} {
+						if err := tree.Update(m.key(i), []byte(fmt.Sprint(i))); err != nil {
+							t.Fatal(err)
+						}
+					}
+				}
+				pairs := b.pairs(m.key)
+				for _, p := range pairs {
+					if err := sequential.Update(p.Key, p.Value); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := batched.UpdateBatch(pairs); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(batched.GetRoot(), sequential.GetRoot()) {
+					t.Errorf("batch root %x, sequential root %x", batched.GetRoot(), sequential.GetRoot())
+				}
+				for _, p := range pairs {
+					value, _, err := batched.Get(p.Key)
+					want, _, _ := sequential.Get(p.Key)
+					if err != nil || !bytes.Equal(value, want) {
+						t.Errorf("key %x: got %q (%v), want %q", p.Key, value, err, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestUpdateBatchRejected 出错时整批写入都不生效
+func TestUpdateBatchRejected(t *testing.T) {
+	a, b := collidingKeys(t, 16)
+	tests := []struct {
+		name  string
+		depth int
+		opts  []Option
+		seed  []KeyValue
+		pairs []KeyValue
+		want  error
+	}{
+		{
+			name:  "collision with the tree",
+			depth: 16,
+			seed:  []KeyValue{{Key: a, Value: []byte("a")}},
+			pairs: []KeyValue{{Key: []byte("other"), Value: []byte("1")}, {Key: b, Value: []byte("b")}},
+			want:  ErrKeyCollision,
+		},
+		{
+			name:  "collision within the batch",
+			depth: 16,
+			pairs: []KeyValue{{Key: a, Value: []byte("a")}, {Key: b, Value: []byte("b")}},
+			want:  ErrKeyCollision,
+		},
+		{
+			name:  "raw key length",
+			depth: 64,
+			opts:  []Option{WithRawKeys()},
+			pairs: []KeyValue{{Key: height(1), Value: []byte("1")}, {Key: []byte("short"), Value: []byte("2")}},
+			want:  ErrInvalidKeyLength,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewSparseMerkleTree(tt.depth, tt.opts...)
+			if err := tree.UpdateBatch(tt.seed); err != nil {
+				t.Fatal(err)
+			}
+			before := tree.GetRoot()
+			if err := tree.UpdateBatch(tt.pairs); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if !bytes.Equal(tree.GetRoot(), before) {
+				t.Error("rejected batch changed the root")
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentReadWrite 多个读 goroutine 与写入、剪除 goroutine 同时访问同一棵树
+// 写 goroutine 反复 UpdateBatch、Commit，偶尔 Rollback 到上一个版本；
+// 剪除 goroutine 独立地反复调用 PruneVersions；读 goroutine 同时：
+//   - 在 View 上读取值、生成证明并用视图的根验证，遍历 Leaves 时所有值必须相同
+//   - 在最近提交的版本上读取，第 v 个版本中每个键的值都必须是 v
+//   - 在当前树上 Get、GenerateProof，并生成多键证明，返回的所有值必须相同
+// 需要用 go test -race 运行，锁的遗漏会被竞争检测器报告
+func TestConcurrentReadWrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		store bool // 是否使用节点存储；使用时剪除会回收节点，读到刚被剪除的版本是允许的
+	}{
+		{"memory", false},
+		{"node store", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithShortcutLeaves()}
+			treeOpts := opts
+			if tt.store {
+				treeOpts = append(treeOpts, WithNodeStore(NewMemoryNodeStore()))
+			}
+			tree := NewSparseMerkleTree(256, treeOpts...)
+			runConcurrent(t, tree, opts, tt.store, 4, 200)
+		})
+	}
+}
+
+// runConcurrent 在 tree 上运行 readers 个读 goroutine、一个写 goroutine 和一个剪除 goroutine，
+// 写 goroutine 提交 rounds 个版本后结束
+// 参数:
+//   opts: 验证证明时使用的选项
+//   pruned: 是否允许读操作返回 ErrNodeNotFound（版本在读取过程中被剪除）
+func runConcurrent(t *testing.T, tree *SparseMerkleTree, opts []Option, pruned bool, readers, rounds int) {
+	keys := make([][]byte, 20)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("account%d", i))
+	}
+	var (
+		done = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	// gone 报告 err 是否是允许的"版本已被剪除"错误
+	gone := func(err error) bool {
+		return pruned && errors.Is(err, ErrNodeNotFound)
+	}
+	// same 检查一组值是否全部相同；want 不为 nil 时还必须等于 want
+	same := func(source string, values [][]byte, want []byte) {
+		for _, v := range values {
+			if want == nil {
+				want = v
+			}
+			if !bytes.Equal(v, want) {
+				t.Errorf("%s: got %q, want %q", source, v, want)
+				return
+			}
+		}
+	}
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				key := keys[(r+i)%len(keys)]
+				switch i % 3 {
+				case 0:
+					view := tree.View()
+					value, found, err := view.Get(key)
+					if gone(err) {
+						continue
+					}
+					proof, perr := view.GenerateProof(key)
+					if gone(perr) {
+						continue
+					}
+					if err != nil || perr != nil {
+						t.Errorf("view: %v %v", err, perr)
+						continue
+					}
+					if found && !VerifyProof(view.GetRoot(), key, value, proof, opts...) {
+						t.Errorf("view: proof for %s does not match the view root", key)
+					}
+					var values [][]byte
+					for leaf, err := range view.Leaves() {
+						if err != nil {
+							if !gone(err) {
+								t.Errorf("view leaves: %v", err)
+							}
+							values = nil
+							break
+						}
+						values = append(values, leaf.Value)
+					}
+					same("view leaves", values, nil)
+				case 1:
+					version := tree.LatestVersion()
+					snapshot, err := tree.At(version)
+					if errors.Is(err, ErrUnknownVersion) {
+						continue // 版本刚好被剪除或回滚
+					}
+					if err != nil {
+						t.Errorf("at %d: %v", version, err)
+						continue
+					}
+					if version == 0 {
+						continue
+					}
+					value, found, err := snapshot.Get(key)
+					if gone(err) {
+						continue // 取得快照之后该版本被剪除，这是允许的（见 At）
+					}
+					if err != nil || !found {
+						t.Errorf("version %d: %s found=%v err=%v", version, key, found, err)
+						continue
+					}
+					same(fmt.Sprintf("version %d", version), [][]byte{value}, []byte(fmt.Sprint(version)))
+				default:
+					if _, _, err := tree.Get(key); err != nil && !gone(err) {
+						t.Errorf("get: %v", err)
+					}
+					if _, err := tree.GenerateProof(key); err != nil && !gone(err) {
+						t.Errorf("proof: %v", err)
+					}
+					_, entries, err := tree.GenerateMultiProof(keys)
+					if gone(err) {
+						continue
+					}
+					if err != nil {
+						t.Errorf("multiproof: %v", err)
+						continue
+					}
+					values := make([][]byte, len(entries))
+					for j, e := range entries {
+						values[j] = e.Value
+					}
+					same("multiproof", values, nil)
+				}
+			}
+		}(r)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := tree.PruneVersions(3); err != nil {
+				t.Errorf("prune: %v", err)
+			}
+		}
+	}()
+
+	// 写 goroutine：第 v 个版本中每个键的值都是 v，回滚之后版本号从回滚到的版本继续
+	for round := 1; round <= rounds; round++ {
+		next := tree.LatestVersion() + 1
+		pairs := make([]KeyValue, len(keys))
+		for i, key := range keys {
+			pairs[i] = KeyValue{Key: key, Value: []byte(fmt.Sprint(next))}
+		}
+		if err := tree.UpdateBatch(pairs); err != nil {
+			t.Errorf("update: %v", err)
+		}
+		version, err := tree.Commit()
+		if err != nil {
+			t.Errorf("commit: %v", err)
+		}
+		if version != next {
+			t.Errorf("commit: got version %d, want %d", version, next)
+		}
+		if round%7 == 0 && version > 1 {
+			// 上一个版本可能已经被剪除
+			if err := tree.Rollback(version - 1); err != nil && !errors.Is(err, ErrUnknownVersion) {
+				t.Errorf("rollback: %v", err)
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+}
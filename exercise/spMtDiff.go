@@ -0,0 +1,212 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrUnknownRoot 指定的哈希不是树已知的根：既不是空树、树的当前根、某个保留版本的根，也不是预写日志中最近提交的根
+var ErrUnknownRoot = errors.New("smt: unknown root")
+
+// ChangeKind 键的变化类型
+type ChangeKind int
+
+const (
+	ChangeAdded    ChangeKind = iota + 1 // 新增的键
+	ChangeRemoved                        // 删除的键
+	ChangeModified                       // 值发生变化的键
+)
+
+// String 返回变化类型的名称
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Change 两个根之间一个键的变化
+type Change struct {
+	KeyHash  []byte     // 键哈希
+	Kind     ChangeKind // 变化类型
+	OldValue []byte     // 旧值（新增时为 nil）
+	NewValue []byte     // 新值（删除时为 nil）
+}
+
+// Diff 比较两个已提交的版本
+// 参数:
+//   from: 旧版本
+//   to: 新版本
+// 返回:
+//   按键哈希顺序排列的所有变化；版本不存在时返回 ErrUnknownVersion
+func (smt *SparseMerkleTree) Diff(from, to Version) ([]Change, error) {
+	smt.mu.RLock()
+	i, err := smt.versionIndex(from)
+	if err != nil {
+		smt.mu.RUnlock()
+		return nil, err
+	}
+	j, err := smt.versionIndex(to)
+	if err != nil {
+		smt.mu.RUnlock()
+		return nil, err
+	}
+	a, b := smt.versions[i].root, smt.versions[j].root
+	smt.mu.RUnlock()
+	return smt.diff(a, b)
+}
+
+// DiffRoots 比较两个根哈希对应的树
+// 参数:
+//   oldRoot: 旧的根哈希
+//   newRoot: 新的根哈希
+// 返回:
+//   按键哈希顺序排列的所有变化
+//   根哈希必须是树的当前根、某个保留版本的根、空树的根，或者预写日志中最近提交的根，否则返回 ErrUnknownRoot；
+//   存储中的其他节点（例如某棵子树的根）即使存在也不被接受
+// 工作原理:
+//   同时从两个根向下遍历，哈希相同的子树内容一定相同，直接跳过；
+//   因此代价与变化的数量（乘以树的深度）成正比，而与树的大小无关
+func (smt *SparseMerkleTree) DiffRoots(oldRoot, newRoot []byte) ([]Change, error) {
+	smt.mu.RLock()
+	a, err := smt.findRoot(oldRoot)
+	if err != nil {
+		smt.mu.RUnlock()
+		return nil, err
+	}
+	b, err := smt.findRoot(newRoot)
+	smt.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return smt.diff(a, b)
+}
+
+// findRoot 根据根哈希找到根节点，调用者必须持有锁
+// 只接受树自己记录的根，不会按哈希去节点存储中查找：存储中的任意节点都可以按哈希加载，
+// 但以一棵子树的根作为整棵树的根进行比较，得到的结果没有意义
+func (smt *SparseMerkleTree) findRoot(root []byte) (*Node, error) {
+	if bytes.Equal(root, smt.defaults[smt.depth]) {
+		return nil, nil
+	}
+	if smt.root != nil && bytes.Equal(smt.root.hash, root) {
+		return smt.root, nil
+	}
+	for _, v := range smt.versions {
+		if v.root != nil && bytes.Equal(v.root.hash, root) {
+			return v.root, nil
+		}
+	}
+	if smt.journal != nil && bytes.Equal(smt.journal.committed, root) {
+		return stubNode(root), nil
+	}
+	return nil, ErrUnknownRoot
+}
+
+// diff 比较两棵树，返回所有变化
+func (smt *SparseMerkleTree) diff(a, b *Node) ([]Change, error) {
+	var changes []Change
+	if err := smt.diffNodes(a, b, 0, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// diffNodes 递归比较第 depth 层的两棵子树
+// 参数:
+//   a: 旧子树
+//   b: 新子树
+//   depth: 当前深度
+//   changes: 收集到的变化
+// 工作原理:
+//   - 哈希相同（包括两边都为空）时子树相同，直接返回
+//   - 两边都是内部节点时分别比较左右子树
+//   - 一边为空或者是叶子时（捷径模式下叶子可能在任意一层），分别按顺序列出两边的叶子再合并比较；
+//     此时至少一边最多只有一个键，另一边的键除了最多一个之外都是新增或删除的，代价仍与变化数量成正比
+func (smt *SparseMerkleTree) diffNodes(a, b *Node, depth int, changes *[]Change) error {
+	if bytes.Equal(smt.hashOf(a, depth), smt.hashOf(b, depth)) {
+		return nil
+	}
+	a, err := smt.load(a, depth)
+	if err != nil {
+		return err
+	}
+	b, err = smt.load(b, depth)
+	if err != nil {
+		return err
+	}
+
+	if a != nil && b != nil && a.key == nil && b.key == nil {
+		if err := smt.diffNodes(a.left, b.left, depth+1, changes); err != nil {
+			return err
+		}
+		return smt.diffNodes(a.right, b.right, depth+1, changes)
+	}
+
+	oldLeaves, err := smt.subtreeLeaves(a, depth)
+	if err != nil {
+		return err
+	}
+	newLeaves, err := smt.subtreeLeaves(b, depth)
+	if err != nil {
+		return err
+	}
+	mergeChanges(oldLeaves, newLeaves, changes)
+	return nil
+}
+
+// subtreeLeaves 按顺序列出子树中的所有叶子
+func (smt *SparseMerkleTree) subtreeLeaves(node *Node, depth int) ([]Leaf, error) {
+	var leaves []Leaf
+	var walkErr error
+	smt.walkLeaves(node, depth, nil, func(leaf Leaf, err error) bool {
+		if err != nil {
+			walkErr = err
+			return false
+		}
+		leaves = append(leaves, leaf)
+		return true
+	})
+	return leaves, walkErr
+}
+
+// mergeChanges 合并两个有序的叶子列表，得到其中的变化
+func mergeChanges(oldLeaves, newLeaves []Leaf, changes *[]Change) {
+	i, j := 0, 0
+	for i < len(oldLeaves) || j < len(newLeaves) {
+		var c int
+		switch {
+		case i == len(oldLeaves):
+			c = 1
+		case j == len(newLeaves):
+			c = -1
+		default:
+			c = bytes.Compare(oldLeaves[i].KeyHash, newLeaves[j].KeyHash)
+		}
+		switch {
+		case c < 0:
+			*changes = append(*changes, Change{KeyHash: oldLeaves[i].KeyHash, Kind: ChangeRemoved, OldValue: oldLeaves[i].Value})
+			i++
+		case c > 0:
+			*changes = append(*changes, Change{KeyHash: newLeaves[j].KeyHash, Kind: ChangeAdded, NewValue: newLeaves[j].Value})
+			j++
+		default:
+			if !bytes.Equal(oldLeaves[i].Value, newLeaves[j].Value) {
+				*changes = append(*changes, Change{
+					KeyHash:  oldLeaves[i].KeyHash,
+					Kind:     ChangeModified,
+					OldValue: oldLeaves[i].Value,
+					NewValue: newLeaves[j].Value,
+				})
+			}
+			i++
+			j++
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		change func(*SparseMerkleTree) error
+		want   map[string]ChangeKind // 键 -> 变化类型
+	}{
+		{
+			name:   "no change",
+			change: func(*SparseMerkleTree) error { return nil },
+		},
+		{
+			name: "mixed",
+			change: func(tree *SparseMerkleTree) error {
+				if err := tree.Update([]byte("account3"), []byte("changed")); err != nil {
+					return err
+				}
+				if _, err := tree.Delete([]byte("account5")); err != nil {
+					return err
+				}
+				return tree.Update([]byte("account100"), []byte("new"))
+			},
+			want: map[string]ChangeKind{"account3": ChangeModified, "account5": ChangeRemoved, "account100": ChangeAdded},
+		},
+		{
+			name: "same value",
+			change: func(tree *SparseMerkleTree) error {
+				return tree.Update([]byte("account3"), []byte("3"))
+			},
+		},
+		{
+			// 捷径模式下叶子可能停在任意一层，新增的键会把叶子推到更深的位置
+			name: "shortcut split",
+			opts: []Option{WithShortcutLeaves()},
+			change: func(tree *SparseMerkleTree) error {
+				return tree.UpdateBatch([]KeyValue{
+					{Key: []byte("account100"), Value: []byte("new")},
+					{Key: []byte("account101"), Value: []byte("new")},
+				})
+			},
+			want: map[string]ChangeKind{"account100": ChangeAdded, "account101": ChangeAdded},
+		},
+		{
+			name: "node store",
+			opts: []Option{WithNodeStore(NewMemoryNodeStore()), WithShortcutLeaves()},
+			change: func(tree *SparseMerkleTree) error {
+				_, err := tree.Delete([]byte("account0"))
+				return err
+			},
+			want: map[string]ChangeKind{"account0": ChangeRemoved},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewSparseMerkleTree(256, tt.opts...)
+			for i := 0; i < 20; i++ {
+				if err := tree.Update([]byte(fmt.Sprintf("account%d", i)), []byte(fmt.Sprint(i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before, err := tree.Commit()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.change(tree); err != nil {
+				t.Fatal(err)
+			}
+			after, err := tree.Commit()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			changes, err := tree.Diff(before, after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != len(tt.want) {
+				t.Fatalf("got %d changes, want %d", len(changes), len(tt.want))
+			}
+			for i, c := range changes {
+				if i > 0 && bytes.Compare(changes[i-1].KeyHash, c.KeyHash) >= 0 {
+					t.Error("changes are not in key hash order")
+				}
+				var key string
+				for k := range tt.want {
+					if bytes.Equal(tree.hashKey([]byte(k)), c.KeyHash) {
+						key = k
+					}
+				}
+				if key == "" || c.Kind != tt.want[key] {
+					t.Errorf("unexpected change %x: %s", c.KeyHash, c.Kind)
+					continue
+				}
+				if (c.OldValue == nil) != (c.Kind == ChangeAdded) || (c.NewValue == nil) != (c.Kind == ChangeRemoved) {
+					t.Errorf("%s %s: old %q, new %q", key, c.Kind, c.OldValue, c.NewValue)
+				}
+			}
+
+			// 反方向比较：新增与删除互换
+			reverse, err := tree.Diff(after, before)
+			if err != nil || len(reverse) != len(changes) {
+				t.Fatalf("reverse diff: got %d changes (%v)", len(reverse), err)
+			}
+			swapped := map[ChangeKind]ChangeKind{ChangeAdded: ChangeRemoved, ChangeRemoved: ChangeAdded, ChangeModified: ChangeModified}
+			for i, c := range reverse {
+				if c.Kind != swapped[changes[i].Kind] || !bytes.Equal(c.OldValue, changes[i].NewValue) {
+					t.Errorf("reverse of %s is %s", changes[i].Kind, c.Kind)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffRootsUnknownRoot(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"memory", nil},
+		{"node store", []Option{WithNodeStore(NewMemoryNodeStore())}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewSparseMerkleTree(256, tt.opts...)
+			if err := tree.Update([]byte("alice"), []byte("100")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tree.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			root := tree.GetRoot()
+			unknown := bytes.Repeat([]byte{0xab}, len(root))
+			if _, err := tree.DiffRoots(unknown, root); !errors.Is(err, ErrUnknownRoot) {
+				t.Errorf("unknown old root: got %v, want ErrUnknownRoot", err)
+			}
+			if _, err := tree.DiffRoots(root, unknown); !errors.Is(err, ErrUnknownRoot) {
+				t.Errorf("unknown new root: got %v, want ErrUnknownRoot", err)
+			}
+			empty := NewSparseMerkleTree(256).GetRoot()
+			changes, err := tree.DiffRoots(empty, root)
+			if err != nil || len(changes) != 1 {
+				t.Errorf("diff from the empty root: got %v, %v", changes, err)
+			}
+
+			// 子树的根即使在存储中也不是树的根
+			if err := tree.Update([]byte("bob"), []byte("200")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tree.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			proof, err := tree.GenerateProof([]byte("alice"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var subtree []byte
+			for _, s := range proof.Siblings {
+				if s != nil {
+					subtree = s // bob 所在的子树
+				}
+			}
+			if subtree == nil {
+				t.Fatal("proof has no non-default sibling")
+			}
+			if _, err := tree.DiffRoots(subtree, tree.GetRoot()); !errors.Is(err, ErrUnknownRoot) {
+				t.Errorf("subtree root: got %v, want ErrUnknownRoot", err)
+			}
+		})
+	}
+}
+
+// TestDiffRootsJournal 重新打开后，预写日志中最近提交的根不是任何保留的版本，但仍然可以与之后的修改比较
+func TestDiffRootsJournal(t *testing.T) {
+	dir := t.TempDir()
+	store := openFileStore(t, filepath.Join(dir, "nodes.db"))
+	open := func() (*SparseMerkleTree, *Journal) {
+		journal, err := OpenJournal(filepath.Join(dir, "journal"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := OpenSparseMerkleTree(256, journal, WithNodeStore(store))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tree, journal
+	}
+
+	tree, journal := open()
+	if err := tree.Update([]byte("alice"), []byte("100")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	committed := tree.GetRoot()
+	journal.Close()
+
+	tree, journal = open()
+	defer journal.Close()
+	if err := tree.Update([]byte("bob"), []byte("200")); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := tree.DiffRoots(committed, tree.GetRoot())
+	if err != nil || len(changes) != 1 || changes[0].Kind != ChangeAdded {
+		t.Errorf("got %v (%v), want bob added", changes, err)
+	}
+}
@@ -0,0 +1,424 @@
+package exercise
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidProofEncoding 证明编码错误
+// UnmarshalBinary/UnmarshalJSON 遇到格式不正确或非规范的编码时返回该错误
+var ErrInvalidProofEncoding = errors.New("smt: invalid proof encoding")
+
+// proofEncodingVersion 证明二进制格式的版本号
+const proofEncodingVersion = 1
+
+// 二进制格式中的标志位
+const (
+	proofFlagExists  = 1 << 0 // 存在性证明
+	proofFlagHasLeaf = 1 << 1 // 路径终点被其他键占用（携带 LeafKey/LeafValueHash）
+)
+
+// MarshalBinary 把证明编码为紧凑的二进制格式
+// 深度为 256 的证明中绝大多数兄弟节点都是空子树，逐个写出 32 字节哈希约需 8KB；
+// 这里用一个位图标记哪些兄弟节点是默认哈希，只写出非默认的兄弟节点
+// 格式（多字节整数均为大端序）:
+//   version   uint8     格式版本，当前为 1
+//   flags     uint8     bit0=Exists，bit1=携带占用槽位的叶子
+//   depth     uint16    树的深度
+//   pathLen   uint16    路径长度 n
+//   path      ⌈n/8⌉字节  路径比特位（高位在前，1=向右）
+//   defaults  ⌈n/8⌉字节  默认兄弟位图（高位在前，1=该层兄弟为空子树，不写出哈希）
+//   hashSize  uint8     兄弟节点哈希的长度（没有非默认兄弟时为 0）
+//   siblings  k*hashSize 非默认兄弟节点，按从根到叶的顺序
+//   leaf      仅当 bit1 置位时出现: uvarint 长度 + LeafKey，uvarint 长度 + LeafValueHash
+// 编码是规范的：位图中的填充位必须为 0，长度必须是最短的 uvarint，且不允许有多余的尾部字节，
+// 因此同一个证明只有唯一的编码
+func (p Proof) MarshalBinary() ([]byte, error) {
+	n := len(p.Path)
+	if len(p.Siblings) != n {
+		return nil, fmt.Errorf("%w: %d siblings for path of length %d", ErrInvalidProofEncoding, len(p.Siblings), n)
+	}
+	if p.Depth < 0 || p.Depth > 0xFFFF || n > p.Depth {
+		return nil, fmt.Errorf("%w: depth %d, path length %d", ErrInvalidProofEncoding, p.Depth, n)
+	}
+	if p.Exists && p.LeafKey != nil {
+		return nil, fmt.Errorf("%w: inclusion proof carries another leaf", ErrInvalidProofEncoding)
+	}
+
+	// 统计非默认兄弟节点，它们的长度必须一致且不为 0（空的兄弟节点无法与默认兄弟区分，解码时会被拒绝）
+	hashSize := 0
+	defaults := make([]bool, n)
+	for i, sibling := range p.Siblings {
+		if sibling == nil {
+			defaults[i] = true
+			continue
+		}
+		if hashSize == 0 {
+			hashSize = len(sibling)
+		}
+		if len(sibling) == 0 || len(sibling) != hashSize || hashSize > 0xFF {
+			return nil, fmt.Errorf("%w: sibling %d has length %d", ErrInvalidProofEncoding, i, len(sibling))
+		}
+	}
+
+	var flags byte
+	if p.Exists {
+		flags |= proofFlagExists
+	}
+	if p.LeafKey != nil {
+		flags |= proofFlagHasLeaf
+	}
+
+	buf := []byte{proofEncodingVersion, flags}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(p.Depth))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	buf = append(buf, packBits(p.Path)...)
+	buf = append(buf, packBits(defaults)...)
+	buf = append(buf, byte(hashSize))
+	for _, sibling := range p.Siblings {
+		buf = append(buf, sibling...)
+	}
+	if p.LeafKey != nil {
+		buf = binary.AppendUvarint(buf, uint64(len(p.LeafKey)))
+		buf = append(buf, p.LeafKey...)
+		buf = binary.AppendUvarint(buf, uint64(len(p.LeafValueHash)))
+		buf = append(buf, p.LeafValueHash...)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary 从 MarshalBinary 产生的二进制格式解码证明
+// 解码只检查格式本身，证明是否有效仍需调用 VerifyProof/VerifyNonInclusionProof
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	r := proofReader{data: data}
+
+	header := r.next(6)
+	if header == nil {
+		return fmt.Errorf("%w: short header", ErrInvalidProofEncoding)
+	}
+	if header[0] != proofEncodingVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidProofEncoding, header[0])
+	}
+	flags := header[1]
+	if flags&^(proofFlagExists|proofFlagHasLeaf) != 0 || flags == proofFlagExists|proofFlagHasLeaf {
+		return fmt.Errorf("%w: bad flags %#x", ErrInvalidProofEncoding, flags)
+	}
+	depth := int(binary.BigEndian.Uint16(header[2:]))
+	n := int(binary.BigEndian.Uint16(header[4:]))
+	if n > depth {
+		return fmt.Errorf("%w: path length %d exceeds depth %d", ErrInvalidProofEncoding, n, depth)
+	}
+
+	path, err := unpackBits(r.next((n+7)/8), n)
+	if err != nil {
+		return err
+	}
+	defaults, err := unpackBits(r.next((n+7)/8), n)
+	if err != nil {
+		return err
+	}
+	sizeByte := r.next(1)
+	if sizeByte == nil {
+		return fmt.Errorf("%w: missing hash size", ErrInvalidProofEncoding)
+	}
+	hashSize := int(sizeByte[0])
+
+	siblings := make([][]byte, n)
+	count := 0
+	for i := range siblings {
+		if defaults[i] {
+			continue
+		}
+		if hashSize == 0 {
+			return fmt.Errorf("%w: zero hash size", ErrInvalidProofEncoding)
+		}
+		if siblings[i] = r.clone(hashSize); siblings[i] == nil {
+			return fmt.Errorf("%w: truncated siblings", ErrInvalidProofEncoding)
+		}
+		count++
+	}
+	if count == 0 && hashSize != 0 {
+		return fmt.Errorf("%w: hash size %d without siblings", ErrInvalidProofEncoding, hashSize)
+	}
+
+	var leafKey, leafValueHash []byte
+	if flags&proofFlagHasLeaf != 0 {
+		if leafKey = r.bytes(); leafKey == nil {
+			return fmt.Errorf("%w: truncated leaf key", ErrInvalidProofEncoding)
+		}
+		if leafValueHash = r.bytes(); leafValueHash == nil {
+			return fmt.Errorf("%w: truncated leaf value hash", ErrInvalidProofEncoding)
+		}
+	}
+	if len(r.data) != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidProofEncoding, len(r.data))
+	}
+
+	*p = Proof{
+		Siblings:      siblings,
+		Path:          path,
+		Exists:        flags&proofFlagExists != 0,
+		LeafKey:       leafKey,
+		LeafValueHash: leafValueHash,
+		Depth:         depth,
+	}
+	return nil
+}
+
+// proofJSON 证明的 JSON 形式
+// 与二进制格式使用相同的紧凑表示，所有字节串都编码为十六进制字符串
+type proofJSON struct {
+	Depth         int      `json:"depth"`                   // 树的深度
+	Exists        bool     `json:"exists"`                  // 是否为存在性证明
+	PathLength    int      `json:"pathLength"`              // 路径长度
+	Path          string   `json:"path"`                    // 路径比特位图
+	Defaults      string   `json:"defaults"`                // 默认兄弟位图
+	Siblings      []string `json:"siblings"`                // 非默认兄弟节点，按从根到叶的顺序
+	LeafKey       string   `json:"leafKey,omitempty"`       // 占用槽位的叶子的键哈希
+	LeafValueHash string   `json:"leafValueHash,omitempty"` // 占用槽位的叶子的值哈希
+}
+
+// MarshalJSON 把证明编码为带十六进制字符串的 JSON
+func (p Proof) MarshalJSON() ([]byte, error) {
+	if len(p.Siblings) != len(p.Path) {
+		return nil, fmt.Errorf("%w: %d siblings for path of length %d", ErrInvalidProofEncoding, len(p.Siblings), len(p.Path))
+	}
+	defaults := make([]bool, len(p.Siblings))
+	siblings := make([]string, 0, len(p.Siblings))
+	for i, sibling := range p.Siblings {
+		if sibling == nil {
+			defaults[i] = true
+			continue
+		}
+		siblings = append(siblings, hex.EncodeToString(sibling))
+	}
+	return json.Marshal(proofJSON{
+		Depth:         p.Depth,
+		Exists:        p.Exists,
+		PathLength:    len(p.Path),
+		Path:          hex.EncodeToString(packBits(p.Path)),
+		Defaults:      hex.EncodeToString(packBits(defaults)),
+		Siblings:      siblings,
+		LeafKey:       hex.EncodeToString(p.LeafKey),
+		LeafValueHash: hex.EncodeToString(p.LeafValueHash),
+	})
+}
+
+// UnmarshalJSON 从 MarshalJSON 产生的 JSON 解码证明
+func (p *Proof) UnmarshalJSON(data []byte) error {
+	var j proofJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if j.PathLength < 0 || j.PathLength > j.Depth || j.Depth > 0xFFFF {
+		return fmt.Errorf("%w: path length %d, depth %d", ErrInvalidProofEncoding, j.PathLength, j.Depth)
+	}
+
+	path, err := decodeHexBits(j.Path, j.PathLength)
+	if err != nil {
+		return err
+	}
+	defaults, err := decodeHexBits(j.Defaults, j.PathLength)
+	if err != nil {
+		return err
+	}
+
+	siblings := make([][]byte, j.PathLength)
+	next := 0
+	for i := range siblings {
+		if defaults[i] {
+			continue
+		}
+		if next >= len(j.Siblings) {
+			return fmt.Errorf("%w: missing siblings", ErrInvalidProofEncoding)
+		}
+		if siblings[i], err = hex.DecodeString(j.Siblings[next]); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidProofEncoding, err)
+		}
+		next++
+	}
+	if next != len(j.Siblings) {
+		return fmt.Errorf("%w: %d extra siblings", ErrInvalidProofEncoding, len(j.Siblings)-next)
+	}
+
+	var leafKey, leafValueHash []byte
+	if j.LeafKey != "" {
+		if j.Exists {
+			return fmt.Errorf("%w: inclusion proof carries another leaf", ErrInvalidProofEncoding)
+		}
+		if leafKey, err = hex.DecodeString(j.LeafKey); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidProofEncoding, err)
+		}
+		if leafValueHash, err = hex.DecodeString(j.LeafValueHash); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidProofEncoding, err)
+		}
+	}
+
+	*p = Proof{
+		Siblings:      siblings,
+		Path:          path,
+		Exists:        j.Exists,
+		LeafKey:       leafKey,
+		LeafValueHash: leafValueHash,
+		Depth:         j.Depth,
+	}
+	return nil
+}
+
+// packBits 把布尔数组打包为位图（高位在前，末尾不足一个字节的部分补 0）
+func packBits(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return packed
+}
+
+// unpackBits 把位图解包为 n 个布尔值，并检查填充位为 0（保证编码规范）
+func unpackBits(packed []byte, n int) ([]bool, error) {
+	if len(packed) != (n+7)/8 {
+		return nil, fmt.Errorf("%w: bitmap has %d bytes for %d bits", ErrInvalidProofEncoding, len(packed), n)
+	}
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = getBit(packed, i)
+	}
+	if n%8 != 0 && packed[len(packed)-1]&(0xFF>>(n%8)) != 0 {
+		return nil, fmt.Errorf("%w: non-zero padding bits", ErrInvalidProofEncoding)
+	}
+	return bits, nil
+}
+
+// decodeHexBits 解码十六进制字符串形式的位图
+func decodeHexBits(s string, n int) ([]bool, error) {
+	packed, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProofEncoding, err)
+	}
+	return unpackBits(packed, n)
+}
+
+// proofReader 顺序读取二进制证明的辅助类型
+type proofReader struct {
+	data []byte // 尚未读取的数据
+}
+
+// next 读取 n 个字节，数据不足时返回 nil（n 为 0 时返回空切片）
+func (r *proofReader) next(n int) []byte {
+	if n > len(r.data) {
+		return nil
+	}
+	b := r.data[:n:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// clone 读取 n 个字节的副本，使解码后的证明不引用调用者的缓冲区
+func (r *proofReader) clone(n int) []byte {
+	b := r.next(n)
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// bytes 读取一个 uvarint 长度前缀的字节串
+// 长度必须是最短的 uvarint 编码（例如 0x80 0x00 也能解码为 0，但不是规范编码），否则返回 nil
+func (r *proofReader) bytes() []byte {
+	length, n := binary.Uvarint(r.data)
+	if n <= 0 || n != len(binary.AppendUvarint(nil, length)) || length > uint64(len(r.data)-n) {
+		return nil
+	}
+	r.data = r.data[n:]
+	return r.clone(int(length))
+}
+
+// multiProofJSON 多键证明的 JSON 形式，所有字节串都编码为十六进制字符串
+type multiProofJSON struct {
+	Depth         int                  `json:"depth"`         // 树的深度
+	TerminalCount int                  `json:"terminalCount"` // 遍历中访问的位置数
+	Terminals     string               `json:"terminals"`     // 每个位置是否为终点的位图
+	Leaves        []multiProofLeafJSON `json:"leaves"`        // 每个终点的内容
+	Siblings      []string             `json:"siblings"`      // 兄弟哈希，空串表示空子树
+}
+
+// multiProofLeafJSON 多键证明中一个终点的 JSON 形式，键为空表示空子树
+type multiProofLeafJSON struct {
+	Key       string `json:"key,omitempty"`
+	ValueHash string `json:"valueHash,omitempty"`
+}
+
+// MarshalJSON 把多键证明编码为带十六进制字符串的 JSON
+func (p MultiProof) MarshalJSON() ([]byte, error) {
+	j := multiProofJSON{
+		Depth:         p.Depth,
+		TerminalCount: len(p.Terminals),
+		Terminals:     hex.EncodeToString(packBits(p.Terminals)),
+		Leaves:        make([]multiProofLeafJSON, len(p.Leaves)),
+		Siblings:      make([]string, len(p.Siblings)),
+	}
+	for i, leaf := range p.Leaves {
+		if leaf.Key == nil && leaf.ValueHash != nil {
+			return nil, fmt.Errorf("%w: empty terminal with a value hash", ErrInvalidProofEncoding)
+		}
+		j.Leaves[i] = multiProofLeafJSON{Key: hex.EncodeToString(leaf.Key), ValueHash: hex.EncodeToString(leaf.ValueHash)}
+	}
+	for i, sibling := range p.Siblings {
+		j.Siblings[i] = hex.EncodeToString(sibling)
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON 从 MarshalJSON 产生的 JSON 解码多键证明
+// 解码只检查格式本身，证明是否有效仍需调用 VerifyMultiProof
+func (p *MultiProof) UnmarshalJSON(data []byte) error {
+	var j multiProofJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if j.TerminalCount < 0 || j.Depth < 0 || j.Depth > 0xFFFF {
+		return fmt.Errorf("%w: %d terminals, depth %d", ErrInvalidProofEncoding, j.TerminalCount, j.Depth)
+	}
+	terminals, err := decodeHexBits(j.Terminals, j.TerminalCount)
+	if err != nil {
+		return err
+	}
+
+	leaves := make([]MultiProofLeaf, len(j.Leaves))
+	for i, leaf := range j.Leaves {
+		if leaf.Key == "" {
+			if leaf.ValueHash != "" {
+				return fmt.Errorf("%w: empty terminal with a value hash", ErrInvalidProofEncoding)
+			}
+			continue
+		}
+		if leaves[i].Key, err = hex.DecodeString(leaf.Key); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidProofEncoding, err)
+		}
+		if leaves[i].ValueHash, err = hex.DecodeString(leaf.ValueHash); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidProofEncoding, err)
+		}
+	}
+	siblings := make([][]byte, len(j.Siblings))
+	for i, sibling := range j.Siblings {
+		if sibling == "" {
+			continue // 空子树
+		}
+		if siblings[i], err = hex.DecodeString(sibling); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidProofEncoding, err)
+		}
+	}
+
+	*p = MultiProof{
+		Terminals: terminals,
+		Leaves:    leaves,
+		Siblings:  siblings,
+		Depth:     j.Depth,
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package exercise
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// encodingProofs 返回覆盖各种证明形态的证明
+func encodingProofs(t *testing.T) map[string]*Proof {
+	t.Helper()
+	full := NewSparseMerkleTree(256)
+	compact := NewSparseMerkleTree(256, WithShortcutLeaves())
+	small := NewSparseMerkleTree(8)
+	for i := 0; i < 20; i++ {
+		key, value := []byte(fmt.Sprintf("account%d", i)), []byte(fmt.Sprint(i))
+		for _, tree := range []*SparseMerkleTree{full, compact, small} {
+			if err := tree.Update(key, value); err != nil && !errors.Is(err, ErrKeyCollision) {
+				t.Fatal(err)
+			}
+		}
+	}
+	a, b := collidingKeys(t, 8)
+	occupied := NewSparseMerkleTree(8)
+	if err := occupied.Update(a, []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	proofs := make(map[string]*Proof)
+	for name, gen := range map[string]func() (*Proof, error){
+		"inclusion":          func() (*Proof, error) { return full.GenerateProof([]byte("account3")) },
+		"empty slot":         func() (*Proof, error) { return full.GenerateProof([]byte("nobody")) },
+		"shortcut inclusion": func() (*Proof, error) { return compact.GenerateProof([]byte("account3")) },
+		"shortcut absence":   func() (*Proof, error) { return compact.GenerateProof([]byte("nobody")) },
+		"shallow":            func() (*Proof, error) { return small.GenerateProof([]byte("account3")) },
+		"occupied slot":      func() (*Proof, error) { return occupied.GenerateProof(b) },
+		"empty tree": func() (*Proof, error) {
+			return NewSparseMerkleTree(256, WithShortcutLeaves()).GenerateProof([]byte("x"))
+		},
+	} {
+		p, err := gen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		proofs[name] = p
+	}
+	if proofs["occupied slot"].LeafKey == nil {
+		t.Fatal("occupied slot proof carries no leaf")
+	}
+	return proofs
+}
+
+func TestProofEncodingRoundTrip(t *testing.T) {
+	for name, proof := range encodingProofs(t) {
+		t.Run(name, func(t *testing.T) {
+			data, err := proof.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded Proof
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&decoded, proof) {
+				t.Errorf("binary round trip: got %+v, want %+v", decoded, *proof)
+			}
+			// 编码是规范的：再次编码得到相同的字节
+			if again, _ := decoded.MarshalBinary(); !bytes.Equal(again, data) {
+				t.Error("re-encoding produced different bytes")
+			}
+
+			text, err := json.Marshal(proof)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fromJSON Proof
+			if err := json.Unmarshal(text, &fromJSON); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&fromJSON, proof) {
+				t.Errorf("JSON round trip: got %+v, want %+v", fromJSON, *proof)
+			}
+		})
+	}
+}
+
+// TestProofEncodingCompact 默认兄弟节点只占位图中的一个比特
+func TestProofEncodingCompact(t *testing.T) {
+	proof := encodingProofs(t)["inclusion"]
+	data, err := proof.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonDefault := 0
+	for _, s := range proof.Siblings {
+		if s != nil {
+			nonDefault++
+		}
+	}
+	// 头部 6 字节 + 两个 32 字节的位图 + 哈希长度 1 字节 + 非默认兄弟
+	if want := 6 + 2*32 + 1 + 32*nonDefault; len(data) != want {
+		t.Errorf("encoded %d bytes, want %d", len(data), want)
+	}
+}
+
+func TestProofUnmarshalBinaryRejected(t *testing.T) {
+	proofs := encodingProofs(t)
+	inclusion, _ := proofs["inclusion"].MarshalBinary()
+	occupied, _ := proofs["occupied slot"].MarshalBinary()
+	short, _ := proofs["shallow"].MarshalBinary() // 路径长度 8，位图恰好一个字节
+
+	mutate := func(data []byte, f func([]byte) []byte) []byte {
+		return f(bytes.Clone(data))
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", inclusion[:5]},
+		{"version", mutate(inclusion, func(b []byte) []byte { b[0] = 2; return b })},
+		{"unknown flag", mutate(inclusion, func(b []byte) []byte { b[1] |= 0x80; return b })},
+		{"exists with leaf", mutate(occupied, func(b []byte) []byte { b[1] |= proofFlagExists; return b })},
+		{"path longer than depth", mutate(inclusion, func(b []byte) []byte { b[2], b[3] = 0, 1; return b })},
+		{"truncated siblings", inclusion[:len(inclusion)-1]},
+		{"trailing bytes", append(bytes.Clone(inclusion), 0)},
+		{"truncated leaf", occupied[:len(occupied)-1]},
+		{"non-minimal leaf length", nonMinimalLeafKey(t, occupied)},
+		{"padding bits", mutate(short, func(b []byte) []byte {
+			// 把路径长度改为 7，最后一位成为必须为 0 的填充位
+			b[5] = 7
+			b[6] |= 0x01
+			return b
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Proof
+			if err := p.UnmarshalBinary(tt.data); !errors.Is(err, ErrInvalidProofEncoding) {
+				t.Errorf("got %v, want ErrInvalidProofEncoding", err)
+			}
+		})
+	}
+}
+
+// nonMinimalLeafKey 把编码中 LeafKey 的长度改写为非最短的两字节 uvarint
+func nonMinimalLeafKey(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var p Proof
+	if err := p.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	// leaf 部分: uvarint(len(LeafKey)) | LeafKey | uvarint(len(LeafValueHash)) | LeafValueHash，两个长度都小于 128
+	at := len(data) - 1 - len(p.LeafValueHash) - len(p.LeafKey) - 1
+	if int(data[at]) != len(p.LeafKey) {
+		t.Fatalf("leaf key length not found at %d", at)
+	}
+	out := append(bytes.Clone(data[:at]), data[at]|0x80, 0x00)
+	return append(out, data[at+1:]...)
+}
+
+func TestProofMarshalBinaryRejected(t *testing.T) {
+	proof := encodingProofs(t)["inclusion"]
+	tests := []struct {
+		name   string
+		mutate func(p *Proof)
+	}{
+		{"sibling count", func(p *Proof) { p.Siblings = p.Siblings[1:] }},
+		{"path longer than depth", func(p *Proof) { p.Depth = len(p.Path) - 1 }},
+		{"inclusion with leaf", func(p *Proof) { p.LeafKey = []byte{1} }},
+		{"empty sibling", func(p *Proof) {
+			// 唯一的非默认兄弟为空时，编码中的哈希长度为 0，解码时无法还原
+			clear(p.Siblings)
+			p.Siblings[0] = []byte{}
+		}},
+		{"mixed sibling sizes", func(p *Proof) {
+			for i, s := range p.Siblings {
+				if s != nil {
+					p.Siblings[i] = s[:16]
+					return
+				}
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := *proof
+			p.Siblings = append([][]byte(nil), proof.Siblings...)
+			tt.mutate(&p)
+			if _, err := p.MarshalBinary(); !errors.Is(err, ErrInvalidProofEncoding) {
+				t.Errorf("got %v, want ErrInvalidProofEncoding", err)
+			}
+		})
+	}
+}
+
+func TestMultiProofJSONRoundTrip(t *testing.T) {
+	tree := NewSparseMerkleTree(256, WithShortcutLeaves())
+	for i := 0; i < 20; i++ {
+		if err := tree.Update([]byte(fmt.Sprintf("account%d", i)), []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proof, entries, err := tree.GenerateMultiProof([][]byte{[]byte("account1"), []byte("nobody"), []byte("account9")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded MultiProof
+	if err := json.Unmarshal(text, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyMultiProof(tree.GetRoot(), entries, &decoded, WithShortcutLeaves()) {
+		t.Error("decoded multiproof does not verify")
+	}
+}
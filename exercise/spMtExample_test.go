@@ -0,0 +1,73 @@
+package exercise
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// Example 演示稀疏默克尔树的基本用法：插入、查询、生成和验证证明
+func Example() {
+	// 创建深度为 8 的稀疏默克尔树
+	smt := NewSparseMerkleTree(8)
+
+	fmt.Println("=== 稀疏默克尔树示例 ===")
+
+	// 插入一些键值对
+	fmt.Println("1. 插入键值对:")
+	data := map[string]string{
+		"alice": "100",
+		"bob":   "200",
+		"carol": "300",
+	}
+
+	for key, value := range data {
+		if err := smt.Update([]byte(key), []byte(value)); err != nil {
+			fmt.Printf("   插入 %s 失败: %v\n", key, err)
+			continue
+		}
+		fmt.Printf("   插入: %s = %s\n", key, value)
+	}
+
+	// 显示根哈希
+	fmt.Printf("\n2. 根哈希: %s\n", hex.EncodeToString(smt.GetRoot()))
+
+	// 查询值
+	fmt.Println("\n3. 查询值:")
+	if value, found, _ := smt.Get([]byte("alice")); found {
+		fmt.Printf("   alice = %s\n", string(value))
+	}
+	if value, found, _ := smt.Get([]byte("bob")); found {
+		fmt.Printf("   bob = %s\n", string(value))
+	}
+	if _, found, _ := smt.Get([]byte("dave")); !found {
+		fmt.Println("   dave 不存在")
+	}
+
+	// 生成证明
+	fmt.Println("\n4. 生成 Merkle 证明:")
+	proof, _ := smt.GenerateProof([]byte("alice"))
+	fmt.Printf("   alice 的证明包含 %d 个兄弟节点\n", len(proof.Siblings))
+
+	// 验证证明
+	fmt.Println("\n5. 验证 Merkle 证明:")
+	valid := smt.VerifyProof([]byte("alice"), []byte("100"), proof)
+	fmt.Printf("   alice=100 的证明验证: %v\n", valid)
+
+	// 验证错误的值
+	invalid := smt.VerifyProof([]byte("alice"), []byte("999"), proof)
+	fmt.Printf("   alice=999 的证明验证: %v\n", invalid)
+
+	// 更新值
+	fmt.Println("\n6. 更新值:")
+	smt.Update([]byte("alice"), []byte("150"))
+	fmt.Println("   更新 alice = 150")
+	if value, found, _ := smt.Get([]byte("alice")); found {
+		fmt.Printf("   新值: alice = %s\n", string(value))
+	}
+	fmt.Printf("   新根哈希: %s\n", hex.EncodeToString(smt.GetRoot()))
+
+	// 旧证明应该失效
+	fmt.Println("\n7. 旧证明验证:")
+	stillValid := smt.VerifyProof([]byte("alice"), []byte("100"), proof)
+	fmt.Printf("   旧证明(alice=100)验证: %v (应该为 false)\n", stillValid)
+}
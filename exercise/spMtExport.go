@@ -0,0 +1,358 @@
+package exercise
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 导出的节点类型
+const (
+	ExportInternal  = "internal"  // 内部节点
+	ExportLeaf      = "leaf"      // 叶子
+	ExportEmpty     = "empty"     // 空子树（哈希为该高度的默认哈希）
+	ExportTruncated = "truncated" // 超出深度限制、没有展开的子树
+)
+
+// 节点在高亮的证明路径中的角色
+const (
+	ExportOnPath  = "path"    // 位于被高亮的键的路径上
+	ExportSibling = "sibling" // 路径上节点的兄弟，即证明中的兄弟哈希
+)
+
+// ExportOption 导出树结构时的选项
+type ExportOption func(*exportConfig)
+
+// exportConfig 导出选项
+type exportConfig struct {
+	maxDepth  int      // 展开的最大深度，负数表示不限制
+	collapse  bool     // 是否折叠空子树
+	highlight [][]byte // 要高亮证明路径的原始键
+}
+
+// ExportMaxDepth 只展开前 depth 层，更深的非空子树导出为 ExportTruncated 节点（只有哈希）
+func ExportMaxDepth(depth int) ExportOption {
+	return func(c *exportConfig) {
+		c.maxDepth = depth
+	}
+}
+
+// ExportCollapseDefaults 折叠空子树
+// 不导出空子树，并把只有一侧非空的内部节点链合并为一条边（边上标注跳过的路径比特），
+// 非捷径模式下每个叶子上方都有一条这样的长链，折叠后树的大小与叶子数成正比
+// 注意:
+//   被合并的中间节点不再单独导出；高亮的证明路径中作为兄弟的节点总会保留
+func ExportCollapseDefaults() ExportOption {
+	return func(c *exportConfig) {
+		c.collapse = true
+	}
+}
+
+// ExportHighlight 高亮键的证明路径：路径上的节点标记为 ExportOnPath，证明中的兄弟节点标记为 ExportSibling
+// 可以多次使用以同时高亮多个键（与多键证明覆盖的节点相同）
+func ExportHighlight(key []byte) ExportOption {
+	return func(c *exportConfig) {
+		c.highlight = append(c.highlight, key)
+	}
+}
+
+// TreeExport JSON 导出的顶层结构
+type TreeExport struct {
+	Root      string      `json:"root"`                // 根哈希（十六进制）
+	Depth     int         `json:"depth"`               // 树的深度
+	Hasher    string      `json:"hasher"`              // 哈希算法名称
+	Highlight []string    `json:"highlight,omitempty"` // 被高亮的键哈希（十六进制）
+	Tree      *ExportNode `json:"tree"`                // 根节点
+}
+
+// ExportNode 导出的一个节点，所有字节数组都以完整的十六进制表示
+type ExportNode struct {
+	Kind  string      `json:"kind"`            // 节点类型，见 ExportInternal 等常量
+	Path  string      `json:"path"`            // 从根到该节点的路径比特，例如 "0110"；根为空串
+	Depth int         `json:"depth"`           // 节点所在的深度
+	Hash  string      `json:"hash"`            // 节点哈希
+	Sum   *uint64     `json:"sum,omitempty"`   // 求和树中子树的总额
+	Key   string      `json:"key,omitempty"`   // 叶子的键哈希
+	Value string      `json:"value,omitempty"` // 叶子的值
+	Role  string      `json:"role,omitempty"`  // 在高亮的证明路径中的角色
+	Left  *ExportNode `json:"left,omitempty"`  // 左子树
+	Right *ExportNode `json:"right,omitempty"` // 右子树
+}
+
+// Export 导出当前树的结构
+// 参数:
+//   opts: 导出选项（深度限制、折叠空子树、高亮证明路径）
+// 返回:
+//   树结构；高亮的键长度不合法（原始键模式）或加载节点失败时返回错误
+// 注意:
+//   不限制深度时会加载并导出整棵树，只适合调试规模的树
+func (smt *SparseMerkleTree) Export(opts ...ExportOption) (*TreeExport, error) {
+	cfg := exportConfig{maxDepth: -1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	e := &exporter{tree: smt, cfg: cfg}
+	out := &TreeExport{Depth: smt.depth, Hasher: smt.hasher.Name()}
+	for _, key := range cfg.highlight {
+		if err := smt.checkKey(key, smt.depth); err != nil {
+			return nil, err
+		}
+		keyHash := smt.hashKey(key)
+		e.paths = append(e.paths, keyHash)
+		out.Highlight = append(out.Highlight, hex.EncodeToString(keyHash))
+	}
+
+	root := smt.currentRoot()
+	node, err := e.export(root, 0, make([]byte, smt.keySize(smt.depth)))
+	if err != nil {
+		return nil, err
+	}
+	out.Root = node.Hash
+	out.Tree = node
+	return out, nil
+}
+
+// WriteJSON 把树结构以 JSON 格式写入 w，格式见 TreeExport
+func (smt *SparseMerkleTree) WriteJSON(w io.Writer, opts ...ExportOption) error {
+	out, err := smt.Export(opts...)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// WriteDOT 把树结构以 Graphviz DOT 格式写入 w
+// 标签中的哈希只显示前 8 字节，完整的哈希在 tooltip 中；
+// 高亮的证明路径以红色粗线表示，证明中的兄弟节点以橙色表示，空子树为灰色虚线框
+// 示例:
+//   smt.WriteDOT(f, ExportHighlight([]byte("alice")), ExportCollapseDefaults())
+//   然后执行 dot -Tsvg tree.dot -o tree.svg
+func (smt *SparseMerkleTree) WriteDOT(w io.Writer, opts ...ExportOption) error {
+	out, err := smt.Export(opts...)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph smt {\n")
+	fmt.Fprintf(bw, "  label=%s;\n", dotQuote(fmt.Sprintf("depth=%d hasher=%s root=%s", out.Depth, out.Hasher, shortHex(out.Root))))
+	fmt.Fprintf(bw, "  node [shape=box, fontname=\"monospace\", fontsize=10];\n")
+	fmt.Fprintf(bw, "  edge [fontname=\"monospace\", fontsize=9];\n")
+	id := 0
+	writeDOTNode(bw, out.Tree, &id)
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+// WriteJSON 把该版本的树结构以 JSON 格式写入 w，见 SparseMerkleTree.WriteJSON
+func (s *Snapshot) WriteJSON(w io.Writer, opts ...ExportOption) error {
+	return s.tree.WriteJSON(w, opts...)
+}
+
+// WriteDOT 把该版本的树结构以 DOT 格式写入 w，见 SparseMerkleTree.WriteDOT
+func (s *Snapshot) WriteDOT(w io.Writer, opts ...ExportOption) error {
+	return s.tree.WriteDOT(w, opts...)
+}
+
+// exporter 导出时的状态
+type exporter struct {
+	tree  *SparseMerkleTree
+	cfg   exportConfig
+	paths [][]byte // 被高亮的键哈希
+}
+
+// export 导出第 depth 层、路径为 path 的子树
+// 参数:
+//   node: 子树的根节点，nil 表示空子树
+//   depth: 当前深度
+//   path: 前 depth 位为当前节点路径的键（其余位为 0）
+func (e *exporter) export(node *Node, depth int, path []byte) (*ExportNode, error) {
+	node, err := e.tree.load(node, depth)
+	if err != nil {
+		return nil, err
+	}
+	out := &ExportNode{
+		Path:  pathBits(path, depth),
+		Depth: depth,
+		Role:  e.role(path, depth),
+	}
+	hash := e.tree.defaults[e.tree.depth-depth]
+	switch {
+	case node == nil:
+		out.Kind = ExportEmpty
+	case node.key != nil:
+		out.Kind = ExportLeaf
+		out.Key = hex.EncodeToString(node.key)
+		out.Value = hex.EncodeToString(node.value)
+		hash = node.hash
+	case e.cfg.maxDepth >= 0 && depth >= e.cfg.maxDepth:
+		out.Kind = ExportTruncated
+		hash = node.hash
+	default:
+		out.Kind = ExportInternal
+		hash = node.hash
+	}
+	out.Hash = hex.EncodeToString(hash)
+	if e.tree.sum {
+		if sum, ok := e.tree.digestSum(hash); ok {
+			out.Sum = &sum
+		}
+	}
+	if out.Kind != ExportInternal {
+		return out, nil
+	}
+
+	for i, child := range []*Node{node.left, node.right} {
+		childPath, childDepth := withBit(path, depth, i == 1), depth+1
+		if e.cfg.collapse {
+			if child == nil {
+				continue
+			}
+			child, childDepth, err = e.skipChain(child, childDepth, childPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+		exported, err := e.export(child, childDepth, childPath)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			out.Left = exported
+		} else {
+			out.Right = exported
+		}
+	}
+	return out, nil
+}
+
+// skipChain 折叠模式下跳过只有一侧非空的内部节点链，返回链末端的节点及其深度
+// 跳过的比特会写入 path；深度限制处、证明中的兄弟节点处停止
+func (e *exporter) skipChain(node *Node, depth int, path []byte) (*Node, int, error) {
+	for {
+		if e.cfg.maxDepth >= 0 && depth >= e.cfg.maxDepth {
+			return node, depth, nil
+		}
+		loaded, err := e.tree.load(node, depth)
+		if err != nil {
+			return nil, 0, err
+		}
+		if loaded.key != nil || (loaded.left != nil) == (loaded.right != nil) || e.role(path, depth) == ExportSibling {
+			return node, depth, nil
+		}
+		next := loaded.left
+		if next == nil {
+			next = loaded.right
+			path[depth/8] |= 0x80 >> (depth % 8)
+		}
+		node, depth = next, depth+1
+	}
+}
+
+// role 返回路径前 depth 位为 path 的节点在高亮的证明路径中的角色
+func (e *exporter) role(path []byte, depth int) string {
+	role := ""
+	for _, keyHash := range e.paths {
+		switch {
+		case commonPrefix(keyHash, path, depth) == depth:
+			return ExportOnPath
+		case depth > 0 && commonPrefix(keyHash, path, depth-1) == depth-1:
+			role = ExportSibling
+		}
+	}
+	return role
+}
+
+// writeDOTNode 以 DOT 格式输出节点及其子树，id 为下一个可用的节点编号；返回该节点的编号
+func writeDOTNode(w io.Writer, n *ExportNode, id *int) int {
+	self := *id
+	*id++
+
+	label := shortHex(n.Hash)
+	if n.Depth == 0 {
+		label = "root\n" + label
+	}
+	attrs := []string{}
+	switch n.Kind {
+	case ExportLeaf:
+		label += "\nkey " + shortHex(n.Key) + "\nvalue " + valueLabel(n.Value)
+		attrs = append(attrs, `shape=note`)
+	case ExportEmpty:
+		label = fmt.Sprintf("empty d=%d\n%s", n.Depth, label)
+		attrs = append(attrs, `style=dashed`, `color=gray`, `fontcolor=gray`)
+	case ExportTruncated:
+		label += "\n..."
+		attrs = append(attrs, `shape=box3d`)
+	}
+	if n.Sum != nil {
+		label += fmt.Sprintf("\nsum %d", *n.Sum)
+	}
+	switch n.Role {
+	case ExportOnPath:
+		attrs = append(attrs, `color=red`, `penwidth=2`)
+	case ExportSibling:
+		attrs = append(attrs, `color=orange`, `penwidth=2`)
+	}
+	attrs = append(attrs, "label="+dotQuote(label), "tooltip="+dotQuote(n.Hash))
+	fmt.Fprintf(w, "  n%d [%s];\n", self, strings.Join(attrs, ", "))
+
+	for _, child := range []*ExportNode{n.Left, n.Right} {
+		if child == nil {
+			continue
+		}
+		childID := writeDOTNode(w, child, id)
+		edge := []string{"label=" + dotQuote(child.Path[n.Depth:])}
+		if n.Role == ExportOnPath && child.Role == ExportOnPath {
+			edge = append(edge, `color=red`, `penwidth=2`)
+		}
+		fmt.Fprintf(w, "  n%d -> n%d [%s];\n", self, childID, strings.Join(edge, ", "))
+	}
+	return self
+}
+
+// pathBits 把路径的前 depth 位格式化为 "0"/"1" 组成的字符串
+func pathBits(path []byte, depth int) string {
+	var b strings.Builder
+	for i := 0; i < depth; i++ {
+		if getBit(path, i) {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+// shortHex 截断十六进制字符串，只保留前 8 字节
+func shortHex(s string) string {
+	if len(s) <= 16 {
+		return s
+	}
+	return s[:16] + "..."
+}
+
+// valueLabel 值的显示形式：可打印的 UTF-8 文本原样显示，否则显示截断的十六进制
+func valueLabel(hexValue string) string {
+	value, err := hex.DecodeString(hexValue)
+	if err == nil && utf8.Valid(value) && !strings.ContainsFunc(string(value), unicode.IsControl) {
+		if runes := []rune(string(value)); len(runes) > 32 {
+			return string(runes[:32]) + "..."
+		}
+		return string(value)
+	}
+	return "0x" + shortHex(hexValue)
+}
+
+// dotQuote 把字符串转换为 DOT 中带引号的字符串，换行转换为 DOT 的居中换行
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,162 @@
+package exercise
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// walkExport 深度优先遍历导出的节点
+func walkExport(n *ExportNode, visit func(*ExportNode)) {
+	if n == nil {
+		return
+	}
+	visit(n)
+	walkExport(n.Left, visit)
+	walkExport(n.Right, visit)
+}
+
+func TestExport(t *testing.T) {
+	keys := []string{"alice", "bob", "carol", "dave"}
+	tree := NewSparseMerkleTree(8)
+	for _, key := range keys {
+		if err := tree.Update([]byte(key), []byte(key+"-value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bob := hex.EncodeToString(tree.hashKey([]byte("bob")))
+
+	tests := []struct {
+		name  string
+		opts  []ExportOption
+		check func(t *testing.T, nodes []*ExportNode)
+	}{
+		{
+			name: "full",
+			check: func(t *testing.T, nodes []*ExportNode) {
+				// 每个内部节点的哈希都必须由两个子节点重新算出
+				for _, n := range nodes {
+					if n.Kind != ExportInternal {
+						continue
+					}
+					left, _ := hex.DecodeString(n.Left.Hash)
+					right, _ := hex.DecodeString(n.Right.Hash)
+					if got := hex.EncodeToString(tree.hashNodes(left, right)); got != n.Hash {
+						t.Errorf("node %q: hash %s, children hash to %s", n.Path, n.Hash, got)
+					}
+				}
+			},
+		},
+		{
+			name: "collapse defaults",
+			opts: []ExportOption{ExportCollapseDefaults()},
+			check: func(t *testing.T, nodes []*ExportNode) {
+				for _, n := range nodes {
+					if n.Kind == ExportEmpty {
+						t.Errorf("empty subtree %q exported", n.Path)
+					}
+				}
+			},
+		},
+		{
+			name: "max depth",
+			opts: []ExportOption{ExportMaxDepth(1)},
+			check: func(t *testing.T, nodes []*ExportNode) {
+				for _, n := range nodes {
+					if n.Depth > 1 {
+						t.Errorf("node %q below the depth limit", n.Path)
+					}
+				}
+			},
+		},
+		{
+			name: "highlight",
+			opts: []ExportOption{ExportHighlight([]byte("bob"))},
+			check: func(t *testing.T, nodes []*ExportNode) {
+				// 路径上每一层恰好一个节点，终点是 bob 的叶子；路径以外的兄弟数与证明的兄弟数相同
+				onPath, siblings := 0, 0
+				for _, n := range nodes {
+					switch n.Role {
+					case ExportOnPath:
+						onPath++
+						if n.Kind == ExportLeaf && n.Key != bob {
+							t.Errorf("highlighted leaf %s, want %s", n.Key, bob)
+						}
+					case ExportSibling:
+						siblings++
+					}
+				}
+				proof, err := tree.GenerateProof([]byte("bob"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if onPath != len(proof.Siblings)+1 || siblings != len(proof.Siblings) {
+					t.Errorf("got %d path nodes and %d siblings, proof has %d siblings", onPath, siblings, len(proof.Siblings))
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tree.Export(tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.Root != hex.EncodeToString(tree.GetRoot()) || out.Depth != 8 || out.Hasher != "sha256" {
+				t.Errorf("header: got root=%s depth=%d hasher=%s", out.Root, out.Depth, out.Hasher)
+			}
+			var nodes []*ExportNode
+			leaves := 0
+			walkExport(out.Tree, func(n *ExportNode) {
+				nodes = append(nodes, n)
+				if n.Kind == ExportLeaf {
+					leaves++
+				}
+			})
+			if tt.name != "max depth" && leaves != len(keys) {
+				t.Errorf("exported %d leaves, want %d", leaves, len(keys))
+			}
+			tt.check(t, nodes)
+		})
+	}
+}
+
+func TestWriteJSONAndDOT(t *testing.T) {
+	tree := NewSparseMerkleTree(256, WithSums(), WithShortcutLeaves())
+	if err := tree.UpdateBatch([]KeyValue{
+		{Key: []byte("alice"), Value: SumValue(150, nil)},
+		{Key: []byte("bob"), Value: SumValue(250, nil)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := tree.WriteJSON(&buf, ExportCollapseDefaults()); err != nil {
+		t.Fatal(err)
+	}
+	var out TreeExport
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Root != hex.EncodeToString(tree.GetRoot()) || out.Tree == nil || out.Tree.Sum == nil || *out.Tree.Sum != 400 {
+		t.Errorf("JSON export: got root %s, tree %+v", out.Root, out.Tree)
+	}
+
+	buf.Reset()
+	if err := tree.WriteDOT(&buf, ExportCollapseDefaults(), ExportHighlight([]byte("bob"))); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	if !strings.HasPrefix(dot, "digraph smt {\n") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("DOT output is not a digraph:\n%s", dot)
+	}
+	if !strings.Contains(dot, "color=red") || !strings.Contains(dot, "sum 400") {
+		t.Errorf("DOT output misses the highlighted path or the sum:\n%s", dot)
+	}
+
+	if _, err := NewSparseMerkleTree(64, WithRawKeys()).Export(ExportHighlight([]byte("short"))); err == nil {
+		t.Error("highlighting a key of the wrong length succeeded")
+	}
+}
@@ -0,0 +1,63 @@
+package exercise
+
+import (
+	"crypto/sha256"
+	"crypto/sha3"
+	"crypto/sha512"
+	"hash"
+)
+
+// Hasher 哈希算法抽象
+// 稀疏默克尔树中的键哈希、叶子哈希和内部节点哈希都通过 Hasher 计算
+// 不同系统使用不同的摘要算法，只有选用相同的 Hasher 才能得到相同的根哈希
+// 实现必须可以被多个 goroutine 同时调用（UpdateBatch 会并行计算哈希）
+type Hasher interface {
+	Name() string               // 算法名称，例如 "sha256"
+	Size() int                  // 输出的哈希长度（字节）
+	Hash(data ...[]byte) []byte // 对若干段数据的拼接结果进行哈希
+}
+
+// 标准库提供的哈希算法
+// 它们的输出都是 32 字节，因此都可以用于 depth<=256 的树
+var (
+	SHA256Hasher     Hasher = newStdHasher("sha256", sha256.New)
+	SHA512_256Hasher Hasher = newStdHasher("sha512/256", sha512.New512_256)
+	SHA3_256Hasher   Hasher = newStdHasher("sha3-256", func() hash.Hash { return sha3.New256() })
+)
+
+// stdHasher 基于标准库 hash.Hash 的 Hasher 实现
+type stdHasher struct {
+	name    string           // 算法名称
+	size    int              // 输出长度
+	newHash func() hash.Hash // 创建新的哈希状态
+}
+
+// newStdHasher 创建基于标准库的 Hasher
+// 参数:
+//   name: 算法名称
+//   newHash: 创建 hash.Hash 的构造函数，例如 sha256.New
+func newStdHasher(name string, newHash func() hash.Hash) *stdHasher {
+	return &stdHasher{
+		name:    name,
+		size:    newHash().Size(),
+		newHash: newHash,
+	}
+}
+
+func (h *stdHasher) Name() string {
+	return h.name
+}
+
+func (h *stdHasher) Size() int {
+	return h.size
+}
+
+// Hash 依次写入每段数据后计算摘要
+// 与先 append 拼接再哈希的结果相同，但不会修改调用者传入的切片
+func (h *stdHasher) Hash(data ...[]byte) []byte {
+	d := h.newHash()
+	for _, b := range data {
+		d.Write(b)
+	}
+	return d.Sum(nil)
+}
@@ -0,0 +1,57 @@
+package exercise
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestHashers(t *testing.T) {
+	hashers := []Hasher{SHA256Hasher, SHA512_256Hasher, SHA3_256Hasher}
+	roots := make(map[string][]byte)
+	for _, hasher := range hashers {
+		t.Run(hasher.Name(), func(t *testing.T) {
+			if hasher.Size() != 32 {
+				t.Errorf("Size: got %d, want 32", hasher.Size())
+			}
+			// 分段哈希与拼接后再哈希的结果相同
+			if !bytes.Equal(hasher.Hash([]byte("ab"), []byte("c")), hasher.Hash([]byte("abc"))) {
+				t.Error("Hash of parts differs from Hash of the concatenation")
+			}
+
+			tree := NewSparseMerkleTree(8, WithHasher(hasher))
+			if err := tree.Update([]byte("alice"), []byte("100")); err != nil {
+				t.Fatal(err)
+			}
+			root := tree.GetRoot()
+			for name, other := range roots {
+				if bytes.Equal(root, other) {
+					t.Errorf("root equals the %s root", name)
+				}
+			}
+			roots[hasher.Name()] = root
+
+			proof, err := tree.GenerateProof([]byte("alice"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, verifier := range hashers {
+				ok := VerifyProof(root, []byte("alice"), []byte("100"), proof, WithHasher(verifier))
+				if want := verifier == hasher; ok != want {
+					t.Errorf("verified with %s: got %v, want %v", verifier.Name(), ok, want)
+				}
+			}
+		})
+	}
+}
+
+// TestDefaultHasher 不指定哈希算法时使用 SHA-256
+func TestDefaultHasher(t *testing.T) {
+	if got := newTreeConfig(nil).hasher; got != SHA256Hasher {
+		t.Errorf("default hasher: got %s, want sha256", got.Name())
+	}
+	want := sha256.Sum256([]byte("abc"))
+	if got := SHA256Hasher.Hash([]byte("abc")); !bytes.Equal(got, want[:]) {
+		t.Errorf("SHA256Hasher: got %x, want %x", got, want)
+	}
+}
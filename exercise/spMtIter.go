@@ -0,0 +1,116 @@
+package exercise
+
+import (
+	"bytes"
+	"iter"
+)
+
+// Leaf 迭代时得到的一个叶子
+type Leaf struct {
+	KeyHash []byte // 键哈希（树中只保存键哈希，不保存原始键）；原始键模式下就是键本身
+	Value   []byte // 值
+}
+
+// Leaves 按键哈希从小到大的顺序遍历所有叶子
+// 返回:
+//   可用于 for range 的迭代器；循环中 break 会立即停止遍历
+//   使用节点存储时，加载节点失败会产生一个 (Leaf{}, err) 并结束遍历
+// 注意:
+//   树是写时复制的，每次 range 开始时取得当时的根，遍历的就是这棵树：
+//   创建迭代器之后、开始遍历之前的修改可以看到，遍历过程中对树的修改不会影响本次遍历；
+//   需要固定在某个时刻的树时使用 View
+// 示例:
+//   for leaf, err := range smt.Leaves() {
+//       if err != nil { ... }
+//       fmt.Printf("%x = %s\n", leaf.KeyHash, leaf.Value)
+//   }
+func (smt *SparseMerkleTree) Leaves() iter.Seq2[Leaf, error] {
+	return smt.LeavesFrom(nil)
+}
+
+// LeavesFrom 从第一个键哈希大于等于 start 的叶子开始，按顺序遍历
+// 参数:
+//   start: 起始位置，按字节序与键哈希比较；可以比键哈希短，此时相当于定位到以 start 为前缀的第一个键
+// 工作原理:
+//   按 start 的比特位向下定位，路径左侧的子树全部小于 start，直接跳过，
+//   因此定位的代价与树的深度成正比，而不是与叶子数量成正比
+func (smt *SparseMerkleTree) LeavesFrom(start []byte) iter.Seq2[Leaf, error] {
+	return func(yield func(Leaf, error) bool) {
+		smt.walkLeaves(smt.currentRoot(), 0, start, yield)
+	}
+}
+
+// LeavesWithPrefix 按顺序遍历键哈希以 prefix 开头的所有叶子
+// 参数:
+//   prefix: 键哈希的字节前缀；为空时遍历所有叶子
+// 工作原理:
+//   从 prefix 处开始遍历（见 LeavesFrom），遇到第一个不以 prefix 开头的键时停止，
+//   由于遍历是有序的，之后的键也都不会以 prefix 开头
+func (smt *SparseMerkleTree) LeavesWithPrefix(prefix []byte) iter.Seq2[Leaf, error] {
+	all := smt.LeavesFrom(prefix)
+	return func(yield func(Leaf, error) bool) {
+		for leaf, err := range all {
+			if err == nil && !bytes.HasPrefix(leaf.KeyHash, prefix) {
+				return
+			}
+			if !yield(leaf, err) {
+				return
+			}
+		}
+	}
+}
+
+// Len 返回树中叶子（键）的数量
+// 需要遍历整棵树，代价与叶子数量成正比
+func (smt *SparseMerkleTree) Len() (int, error) {
+	count := 0
+	for _, err := range smt.Leaves() {
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// walkLeaves 按顺序遍历 node 子树中的叶子
+// 参数:
+//   node: 当前节点
+//   depth: 当前深度
+//   start: 下界；nil 表示子树中的所有叶子都不小于下界
+//   yield: 迭代器的回调
+// 返回:
+//   false 表示遍历已经结束（调用者 break 或者出错），上层应立即返回
+func (smt *SparseMerkleTree) walkLeaves(node *Node, depth int, start []byte, yield func(Leaf, error) bool) bool {
+	node, err := smt.load(node, depth)
+	if err != nil {
+		yield(Leaf{}, err)
+		return false
+	}
+	if node == nil {
+		return true
+	}
+	if node.key != nil {
+		if start != nil && bytes.Compare(node.key, start) < 0 {
+			return true
+		}
+		return yield(Leaf{KeyHash: node.key, Value: node.value}, nil)
+	}
+
+	// 子树中所有键的前 depth 位都等于 start 的前 depth 位，
+	// 超过 start 的长度之后，子树中的键都以 start 为前缀，不再需要比较
+	if start != nil && depth >= len(start)*8 {
+		start = nil
+	}
+	if start == nil {
+		return smt.walkLeaves(node.left, depth+1, nil, yield) &&
+			smt.walkLeaves(node.right, depth+1, nil, yield)
+	}
+	if getBit(start, depth) {
+		// 左子树中的键在这一位上为 0，全部小于 start
+		return smt.walkLeaves(node.right, depth+1, start, yield)
+	}
+	// 右子树中的键在这一位上为 1，全部大于 start
+	return smt.walkLeaves(node.left, depth+1, start, yield) &&
+		smt.walkLeaves(node.right, depth+1, nil, yield)
+}
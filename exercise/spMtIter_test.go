@@ -0,0 +1,157 @@
+package exercise
+
+import (
+	"bytes"
+	"fmt"
+	"iter"
+	"slices"
+	"testing"
+)
+
+// collectLeaves 收集迭代器产生的所有键哈希
+func collectLeaves(t *testing.T, leaves iter.Seq2[Leaf, error]) [][]byte {
+	t.Helper()
+	var keys [][]byte
+	for leaf, err := range leaves {
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, leaf.KeyHash)
+	}
+	return keys
+}
+
+func TestLeavesFrom(t *testing.T) {
+	modes := []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"shortcut", []Option{WithShortcutLeaves()}},
+		{"node store", []Option{WithShortcutLeaves(), WithNodeStore(NewMemoryNodeStore())}},
+	}
+	starts := []struct {
+		name  string
+		start []byte
+	}{
+		{"all", nil},
+		{"upper half", []byte{0x80}},
+		{"past the end", bytes.Repeat([]byte{0xFF}, 33)},
+		{"full key", bytes.Repeat([]byte{0x40}, 32)},
+	}
+	for _, m := range modes {
+		tree := NewSparseMerkleTree(256, m.opts...)
+		var want [][]byte
+		for i := 0; i < 64; i++ {
+			key := []byte(fmt.Sprintf("account%d", i))
+			if err := tree.Update(key, []byte(fmt.Sprint(i))); err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, tree.hashKey(key))
+		}
+		slices.SortFunc(want, bytes.Compare)
+
+		for _, s := range starts {
+			t.Run(m.name+"/"+s.name, func(t *testing.T) {
+				got := collectLeaves(t, tree.LeavesFrom(s.start))
+				i, _ := slices.BinarySearchFunc(want, s.start, bytes.Compare)
+				if !slices.EqualFunc(got, want[i:], bytes.Equal) {
+					t.Errorf("got %d leaves, want %d in order", len(got), len(want)-i)
+				}
+			})
+		}
+		t.Run(m.name+"/len", func(t *testing.T) {
+			if n, err := tree.Len(); err != nil || n != len(want) {
+				t.Errorf("got %d (%v), want %d", n, err, len(want))
+			}
+		})
+	}
+}
+
+func TestLeavesWithPrefix(t *testing.T) {
+	tree := NewSparseMerkleTree(64, WithRawKeys(), WithShortcutLeaves())
+	for _, h := range []uint64{0x0100, 0x0101, 0x01FF, 0x0200, 0x1_0000} {
+		if err := tree.Update(height(h), []byte("block")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		prefix []byte
+		want   []uint64
+	}{
+		{"one byte of height", height(0x0100)[:7], []uint64{0x0100, 0x0101, 0x01FF}},
+		{"below 65536", height(0)[:6], []uint64{0x0100, 0x0101, 0x01FF, 0x0200}},
+		{"exact key", height(0x0200), []uint64{0x0200}},
+		{"no match", height(0x0300)[:7], nil},
+		{"empty", nil, []uint64{0x0100, 0x0101, 0x01FF, 0x0200, 0x1_0000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectLeaves(t, tree.LeavesWithPrefix(tt.prefix))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d leaves, want %d", len(got), len(tt.want))
+			}
+			for i, h := range tt.want {
+				if !bytes.Equal(got[i], height(h)) {
+					t.Errorf("leaf %d: got %x, want %x", i, got[i], height(h))
+				}
+			}
+		})
+	}
+}
+
+// TestLeavesBreak 循环中 break 之后迭代器不能再调用 yield
+func TestLeavesBreak(t *testing.T) {
+	tree := NewSparseMerkleTree(256)
+	for i := 0; i < 10; i++ {
+		if err := tree.Update([]byte(fmt.Sprint(i)), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seen := 0
+	for range tree.Leaves() {
+		seen++
+		if seen == 3 {
+			break
+		}
+	}
+	if seen != 3 {
+		t.Errorf("iterated %d leaves after break at 3", seen)
+	}
+}
+
+// TestLeavesRoot 迭代器在每次 range 开始时取得当前的根，遍历过程中的修改不影响本次遍历
+func TestLeavesRoot(t *testing.T) {
+	tree := NewSparseMerkleTree(64, WithRawKeys())
+	for h := uint64(1); h <= 3; h++ {
+		if err := tree.Update(height(h), []byte("block")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	leaves := tree.Leaves()
+	if err := tree.Update(height(4), []byte("block")); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(collectLeaves(t, leaves)); got != 4 {
+		t.Errorf("first range: %d leaves, want 4 (including the key added before ranging)", got)
+	}
+
+	seen := 0
+	for _, err := range leaves {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen++; seen == 1 {
+			if err := tree.Update(height(5), []byte("block")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if seen != 4 {
+		t.Errorf("second range: %d leaves, want 4 (the key added while ranging is not visited)", seen)
+	}
+	if got := len(collectLeaves(t, leaves)); got != 5 {
+		t.Errorf("third range: %d leaves, want 5", got)
+	}
+}
@@ -0,0 +1,349 @@
+package exercise
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// ErrCorruptJournal 预写日志中的内容无法解释（校验和正确但记录无效，或重放后的根哈希与记录不符）
+	ErrCorruptJournal = errors.New("smt: corrupt journal")
+	// ErrJournalFailed 日志之前的一次写入失败，日志文件的状态已不确定，需要重新打开
+	ErrJournalFailed = errors.New("smt: journal failed, reopen required")
+	// ErrJournalNoStore 使用预写日志时必须同时使用节点存储
+	ErrJournalNoStore = errors.New("smt: journal requires a node store")
+)
+
+// 日志记录类型
+// 每条记录: kind(1 字节) | payloadLen(4 字节，大端) | payload | CRC32(前面所有字段)
+const (
+	journalCommit byte = 1 // 已提交: 节点已完整写入存储的根哈希，只出现在日志开头
+	journalUpdate byte = 2 // 写入: uvarint(len(key)) | key | value
+	journalDelete byte = 3 // 删除: key
+	journalSeal   byte = 4 // 封存: 应用此前所有修改后应得到的根哈希
+)
+
+// journalRecordHeader 每条日志记录的头部长度（kind + payloadLen）
+const journalRecordHeader = 1 + 4
+
+// 写入点名称，故障注入钩子通过它区分每一个可能失败的写入
+const (
+	faultJournalAppend  = "journal.append"          // 追加一条修改或封存记录
+	faultJournalSync    = "journal.sync"            // 封存后刷盘
+	faultStorePut       = "store.put"               // 向节点存储写入一个节点
+	faultStoreSync      = "store.sync"              // 节点存储刷盘
+	faultCompactWrite   = "journal.compact.write"   // 写入新日志的临时文件
+	faultCompactSync    = "journal.compact.sync"    // 临时文件刷盘
+	faultCompactRename  = "journal.compact.rename"  // 用临时文件替换旧日志
+	faultCompactSyncDir = "journal.compact.syncdir" // 目录刷盘，使替换持久化
+	faultSweepSyncDir   = "store.sweep.syncdir"     // Sweep 替换文件后目录刷盘
+	faultSweepReopen    = "store.sweep.reopen"      // Sweep 替换文件后打开新文件
+)
+
+// Journal 树提交的预写日志
+// 与节点存储配合使用，保证进程在任何时刻崩溃后，重新打开时树都处在某个完整提交的状态:
+//   1. Update/Delete/UpdateBatch 在新的根生效之前，先把修改追加到日志
+//   2. Commit 先追加一条封存记录（期望的新根哈希）并刷盘，此后这批修改就不会丢失
+//   3. 然后把新节点写入存储并刷盘
+//   4. 最后用只包含一条"已提交"记录的新日志原子地替换旧日志（写临时文件、刷盘、rename）
+// 重新打开时（见 OpenSparseMerkleTree）:
+//   - 已提交记录中的根总是可以加载的，因为它的节点在日志替换之前已经刷盘
+//   - 如果存在封存记录，重放封存之前的所有修改并完成第 3、4 步，重放后的根必须与封存记录一致
+//   - 封存之后的修改、以及末尾不完整或校验失败的记录，都属于未完成的提交，直接丢弃
+type Journal struct {
+	path      string
+	file      *os.File
+	committed []byte                   // 最近一次提交的根哈希，nil 表示还没有提交过（空树）
+	ops       []journalOp              // 打开时读到的、已提交记录之后的修改
+	sealed    int                      // ops 中被最后一条封存记录覆盖的数量
+	sealRoot  []byte                   // 最后一条封存记录中的根哈希，nil 表示没有封存记录
+	dirty     bool                     // 上次提交之后是否追加过记录
+	err       error                    // 写入失败后的错误，之后的所有写入都直接返回它
+	fault     func(point string) error // 故障注入钩子，返回错误时模拟该写入点失败（崩溃）
+}
+
+// journalOp 日志中记录的一次修改
+type journalOp struct {
+	kind  byte   // journalUpdate 或 journalDelete
+	key   []byte // 原始键
+	value []byte // 写入的值（删除时为 nil）
+}
+
+// OpenJournal 打开或创建预写日志
+// 打开时只读取日志内容，重放或丢弃未完成的提交由 OpenSparseMerkleTree 完成
+// 参数:
+//   path: 日志文件路径，不存在时自动创建；替换日志时会使用 path+".tmp" 作为临时文件
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{path: path, file: file}
+	if err := j.scan(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// scan 读取日志中所有完整的记录，遇到不完整或校验失败的记录时停止
+func (j *Journal) scan() error {
+	info, err := j.file.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(io.NewSectionReader(j.file, 0, info.Size()))
+	header := make([]byte, journalRecordHeader)
+	var offset int64
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil
+		}
+		size := int64(binary.BigEndian.Uint32(header[1:]))
+		if offset+journalRecordHeader+size+4 > info.Size() {
+			return nil // 末尾不完整的记录
+		}
+		body := make([]byte, size+4)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil
+		}
+		crc := crc32.NewIEEE()
+		crc.Write(header)
+		crc.Write(body[:size])
+		if crc.Sum32() != binary.BigEndian.Uint32(body[size:]) {
+			return nil // 写到一半的记录
+		}
+		offset += journalRecordHeader + size + 4
+		if err := j.apply(header[0], body[:size]); err != nil {
+			return err
+		}
+	}
+}
+
+// apply 把读到的一条记录合并到日志的状态中
+func (j *Journal) apply(kind byte, payload []byte) error {
+	switch kind {
+	case journalCommit:
+		j.committed = payload
+		j.ops, j.sealed, j.sealRoot = nil, 0, nil
+	case journalUpdate:
+		keyLen, n := binary.Uvarint(payload)
+		if n <= 0 || keyLen > uint64(len(payload)-n) {
+			return fmt.Errorf("%w: bad update record", ErrCorruptJournal)
+		}
+		rest := payload[n:]
+		j.ops = append(j.ops, journalOp{kind: kind, key: rest[:keyLen], value: rest[keyLen:]})
+	case journalDelete:
+		j.ops = append(j.ops, journalOp{kind: kind, key: payload})
+	case journalSeal:
+		j.sealed, j.sealRoot = len(j.ops), payload
+	default:
+		return fmt.Errorf("%w: unknown record type %d", ErrCorruptJournal, kind)
+	}
+	return nil
+}
+
+// OpenSparseMerkleTree 从节点存储和预写日志中打开树
+// 参数:
+//   depth: 树的深度，必须与写入日志时一致
+//   journal: 由 OpenJournal 打开的日志，之后由树使用，调用者负责在最后关闭它
+//   opts: 树的配置，必须包含 WithNodeStore，并与写入日志时一致
+// 返回:
+//   恢复后的树：日志中有完整封存的提交时会重放它，否则打开最近一次提交的根；
+//   未完成的修改被丢弃，日志被替换为只包含当前根的新日志
+// 注意:
+//   恢复出的树没有历史版本，第一次 Commit 得到版本 1
+func OpenSparseMerkleTree(depth int, journal *Journal, opts ...Option) (*SparseMerkleTree, error) {
+	c := newTreeConfig(opts)
+	if c.store == nil {
+		return nil, ErrJournalNoStore
+	}
+	if err := c.checkStore(); err != nil {
+		return nil, err
+	}
+	smt := NewSparseMerkleTree(depth, append(opts[:len(opts):len(opts)], WithRoot(journal.committed))...)
+	smt.journal = journal
+
+	if journal.sealRoot != nil {
+		// 封存的修改已经持久化，重放它们完成上一次未完成的提交
+		for _, op := range journal.ops[:journal.sealed] {
+			if err := smt.replay(op); err != nil {
+				return nil, err
+			}
+		}
+		if !bytes.Equal(smt.GetRoot(), journal.sealRoot) {
+			return nil, fmt.Errorf("%w: replayed root %x does not match sealed root %x",
+				ErrCorruptJournal, smt.GetRoot(), journal.sealRoot)
+		}
+		if err := smt.flush(); err != nil {
+			return nil, err
+		}
+	}
+	if err := journal.checkpoint(smt.GetRoot()); err != nil {
+		return nil, err
+	}
+	journal.ops, journal.sealed, journal.sealRoot = nil, 0, nil
+	return smt, nil
+}
+
+// replay 重新应用日志中的一次修改（不再写入日志）
+func (smt *SparseMerkleTree) replay(op journalOp) error {
+	keyHash := smt.hashKey(op.key)
+	if op.kind == journalDelete {
+		root, deleted, err := smt.delete(smt.root, keyHash, 0)
+		if err == nil && deleted {
+			smt.root = root
+		}
+		return err
+	}
+	leafHash := smt.hashLeaf(keyHash, smt.hashValue(op.value))
+	root, err := smt.update(smt.root, keyHash, op.value, leafHash, 0)
+	if err == nil {
+		smt.root = root
+	}
+	return err
+}
+
+// logUpdate 在写入生效之前把它追加到日志；没有日志时什么也不做
+func (j *Journal) logUpdate(key, value []byte) error {
+	if j == nil {
+		return nil
+	}
+	payload := binary.AppendUvarint(nil, uint64(len(key)))
+	payload = append(payload, key...)
+	return j.append(journalUpdate, append(payload, value...))
+}
+
+// logDelete 在删除生效之前把它追加到日志；没有日志时什么也不做
+func (j *Journal) logDelete(key []byte) error {
+	if j == nil {
+		return nil
+	}
+	return j.append(journalDelete, key)
+}
+
+// seal 追加封存记录并刷盘，之后这批修改在崩溃后会被重放
+func (j *Journal) seal(root []byte) error {
+	if err := j.append(journalSeal, root); err != nil {
+		return err
+	}
+	return j.write(faultJournalSync, nil, func([]byte) error { return j.file.Sync() })
+}
+
+// append 在日志末尾追加一条记录
+func (j *Journal) append(kind byte, payload []byte) error {
+	err := j.write(faultJournalAppend, encodeJournalRecord(kind, payload), func(rec []byte) error {
+		_, err := j.file.Write(rec)
+		return err
+	})
+	if err == nil {
+		j.dirty = true
+	}
+	return err
+}
+
+// checkpoint 用只包含一条"已提交"记录的新日志原子地替换旧日志
+// 调用前 root 的所有节点必须已经写入存储并刷盘
+func (j *Journal) checkpoint(root []byte) error {
+	if j.err != nil {
+		return j.err
+	}
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return j.fail(err)
+	}
+	err = j.write(faultCompactWrite, encodeJournalRecord(journalCommit, root), func(rec []byte) error {
+		_, err := tmp.Write(rec)
+		return err
+	})
+	if err == nil {
+		err = j.write(faultCompactSync, nil, func([]byte) error { return tmp.Sync() })
+	}
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = j.fail(closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := j.write(faultCompactRename, nil, func([]byte) error { return os.Rename(tmpPath, j.path) }); err != nil {
+		return err
+	}
+	if err := j.write(faultCompactSyncDir, nil, func([]byte) error { return syncDir(filepath.Dir(j.path)) }); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(j.path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return j.fail(err)
+	}
+	j.file.Close()
+	j.file = file
+	j.committed = root
+	j.dirty = false
+	return nil
+}
+
+// write 执行一次写入，写入之前先经过故障注入钩子
+// 钩子返回错误时只写入前一半数据，模拟进程在写到一半时崩溃
+// 任何写入失败之后日志都被标记为失败，需要重新打开
+func (j *Journal) write(point string, data []byte, do func([]byte) error) error {
+	if j.err != nil {
+		return j.err
+	}
+	if err := j.inject(point); err != nil {
+		if len(data) > 0 {
+			do(data[:len(data)/2])
+		}
+		return j.fail(err)
+	}
+	if err := do(data); err != nil {
+		return j.fail(err)
+	}
+	return nil
+}
+
+// inject 调用故障注入钩子；没有日志或没有设置钩子时总是成功
+func (j *Journal) inject(point string) error {
+	if j == nil || j.fault == nil {
+		return nil
+	}
+	return j.fault(point)
+}
+
+// fail 记录写入失败，之后的写入都会返回 ErrJournalFailed
+func (j *Journal) fail(err error) error {
+	j.err = fmt.Errorf("%w: %w", ErrJournalFailed, err)
+	return err
+}
+
+// Close 关闭日志文件
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// encodeJournalRecord 编码一条日志记录（带 CRC32 校验和）
+func encodeJournalRecord(kind byte, payload []byte) []byte {
+	rec := make([]byte, journalRecordHeader, journalRecordHeader+len(payload)+4)
+	rec[0] = kind
+	binary.BigEndian.PutUint32(rec[1:], uint32(len(payload)))
+	rec = append(rec, payload...)
+	return binary.BigEndian.AppendUint32(rec, crc32.ChecksumIEEE(rec))
+}
+
+// syncDir 刷新目录项，使 rename 在崩溃后仍然有效
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,201 @@
+package exercise
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// TestJournalCrashRecovery 对预写日志做故障注入
+// 每个用例先不带故障地执行 setup，然后在执行 op 的第 n 次写入时模拟崩溃；
+// 重新打开时（恢复过程本身也会写入）再在第 m 次写入时崩溃一次，最后正常打开并检查:
+//   - 根哈希必须是 op 之前或之后的根，op 已经返回成功时必须是之后的根
+//   - 每个键的值都与该根对应的状态一致
+// n、m 枚举 op 和恢复过程中所有的写入点，每个组合是一个子测试
+func TestJournalCrashRecovery(t *testing.T) {
+	base := []KeyValue{
+		{Key: []byte("alice"), Value: []byte("100")},
+		{Key: []byte("bob"), Value: []byte("200")},
+		{Key: []byte("carol"), Value: []byte("300")},
+	}
+	commitBase := func(tree *SparseMerkleTree) error {
+		if err := tree.UpdateBatch(base); err != nil {
+			return err
+		}
+		_, err := tree.Commit()
+		return err
+	}
+	change := func(tree *SparseMerkleTree) error {
+		if err := tree.Update([]byte("alice"), []byte("90")); err != nil {
+			return err
+		}
+		if err := tree.Update([]byte("dave"), []byte("10")); err != nil {
+			return err
+		}
+		if _, err := tree.Delete([]byte("bob")); err != nil {
+			return err
+		}
+		_, err := tree.Commit()
+		return err
+	}
+	tests := []struct {
+		name  string
+		setup func(*SparseMerkleTree) error // 不带故障执行
+		op    func(*SparseMerkleTree) error // 在其中注入崩溃
+	}{
+		{
+			name:  "update and delete",
+			setup: commitBase,
+			op:    change,
+		},
+		{
+			name:  "delete only",
+			setup: commitBase,
+			op: func(tree *SparseMerkleTree) error {
+				if _, err := tree.Delete([]byte("carol")); err != nil {
+					return err
+				}
+				_, err := tree.Commit()
+				return err
+			},
+		},
+		{
+			name: "rollback",
+			setup: func(tree *SparseMerkleTree) error {
+				if err := commitBase(tree); err != nil {
+					return err
+				}
+				return change(tree)
+			},
+			op: func(tree *SparseMerkleTree) error { return tree.Rollback(1) },
+		},
+	}
+	keys := [][]byte{[]byte("alice"), []byte("bob"), []byte("carol"), []byte("dave")}
+	opts := []Option{WithShortcutLeaves()}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 参照状态：op 之前和之后
+			before := NewSparseMerkleTree(256, opts...)
+			after := NewSparseMerkleTree(256, opts...)
+			if err := tt.setup(before); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.setup(after); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.op(after); err != nil {
+				t.Fatal(err)
+			}
+
+			// run 执行一个场景，返回 op 与恢复过程中经过的写入次数，用于确定需要枚举的范围
+			run := func(dir string, n, m int) (writes, recoveryWrites int, problem string) {
+				tree, closeAll, err := openCrashTree(dir, opts, nil)
+				if err != nil {
+					return 0, 0, err.Error()
+				}
+				if err := tt.setup(tree); err != nil {
+					closeAll()
+					return 0, 0, err.Error()
+				}
+				tree.journal.fault = crashAt(n, &writes)
+				done := tt.op(tree) == nil
+				closeAll() // 模拟进程崩溃：不做任何清理
+
+				if _, closeAll, err := openCrashTree(dir, opts, crashAt(m, &recoveryWrites)); err == nil {
+					closeAll()
+				}
+				tree, closeAll, err = openCrashTree(dir, opts, nil)
+				if err != nil {
+					return writes, recoveryWrites, err.Error()
+				}
+				defer closeAll()
+				expected := before
+				if done || bytes.Equal(tree.GetRoot(), after.GetRoot()) {
+					expected = after
+				}
+				if !bytes.Equal(tree.GetRoot(), expected.GetRoot()) {
+					return writes, recoveryWrites, fmt.Sprintf("unexpected root %x (op succeeded: %v)", tree.GetRoot(), done)
+				}
+				for _, key := range keys {
+					got, found, err := tree.Get(key)
+					want, wantFound, _ := expected.Get(key)
+					if err != nil || found != wantFound || !bytes.Equal(got, want) {
+						return writes, recoveryWrites, fmt.Sprintf("key %s: got %q (%v, %v), want %q (%v)", key, got, found, err, want, wantFound)
+					}
+				}
+				return writes, recoveryWrites, ""
+			}
+
+			total, _, problem := run(t.TempDir(), 0, 0)
+			if problem != "" {
+				t.Fatalf("without crash: %s", problem)
+			}
+			if total == 0 {
+				t.Fatal("op did not reach any fault point")
+			}
+			for n := 1; n <= total; n++ {
+				_, recovery, _ := run(t.TempDir(), n, 0)
+				for m := 0; m <= recovery; m++ {
+					t.Run(fmt.Sprintf("n=%d/m=%d", n, m), func(t *testing.T) {
+						if _, _, problem := run(t.TempDir(), n, m); problem != "" {
+							t.Error(problem)
+						}
+					})
+				}
+			}
+		})
+	}
+}
+
+// crashAt 返回在第 n 次写入时失败的故障注入钩子（n 为 0 时从不失败），count 记录经过的写入次数
+func crashAt(n int, count *int) func(string) error {
+	return func(point string) error {
+		*count++
+		if *count == n {
+			return fmt.Errorf("injected crash at %s", point)
+		}
+		return nil
+	}
+}
+
+// openCrashTree 打开 dir 下的节点存储和日志并恢复树，fault 在恢复之前设置
+// 返回的函数关闭日志和存储
+func openCrashTree(dir string, opts []Option, fault func(string) error) (*SparseMerkleTree, func(), error) {
+	store, err := OpenFileNodeStore(filepath.Join(dir, "nodes"))
+	if err != nil {
+		return nil, nil, err
+	}
+	journal, err := OpenJournal(filepath.Join(dir, "journal"))
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	closeAll := func() { journal.Close(); store.Close() }
+	journal.fault = fault
+	tree, err := OpenSparseMerkleTree(256, journal, append(opts, WithNodeStore(store))...)
+	if err != nil {
+		closeAll()
+		return nil, nil, err
+	}
+	return tree, closeAll, nil
+}
+
+// TestOpenSparseMerkleTreeOptions 打开树时不能修改调用者传入的选项切片
+func TestOpenSparseMerkleTreeOptions(t *testing.T) {
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	// 切片还有剩余容量，直接 append 会写入调用者的底层数组
+	opts := make([]Option, 1, 2)
+	opts[0] = WithNodeStore(NewMemoryNodeStore())
+	if _, err := OpenSparseMerkleTree(256, journal, opts...); err != nil {
+		t.Fatal(err)
+	}
+	if opts[:2][1] != nil {
+		t.Error("OpenSparseMerkleTree wrote into the caller's options")
+	}
+}
@@ -0,0 +1,316 @@
+package exercise
+
+import (
+	"bytes"
+	"sort"
+)
+
+// MultiProof 多键证明
+// 一次证明多个键（可以同时包含存在和不存在的键），共享的上层路径只出现一次
+// 证明描述的是覆盖所有被证明键的一棵剪枝子树，按深度优先（先左后右）的顺序记录:
+//   - 每访问一个位置，在 Terminals 中记录它是否为终点（空子树或叶子）
+//   - 每个终点在 Leaves 中记录它的内容
+//   - 非终点处，如果被证明的键只落在一侧，在 Siblings 中记录另一侧的哈希；
+//     两侧都有被证明的键时两侧都继续向下遍历，不需要任何兄弟哈希
+// 与逐个调用 GenerateProof 相比，上层的兄弟节点不会重复出现
+type MultiProof struct {
+	Terminals []bool           // 遍历中每个被访问的位置是否为终点
+	Leaves    []MultiProofLeaf // 每个终点的内容，按遍历顺序
+	Siblings  [][]byte         // 只有一侧包含被证明的键时另一侧的哈希，按遍历顺序；nil 表示空子树
+	Depth     int              // 生成证明的树的深度
+}
+
+// MultiProofLeaf 多键证明中一个终点的内容
+type MultiProofLeaf struct {
+	Key       []byte // 叶子的键哈希，nil 表示该终点是空子树
+	ValueHash []byte // 叶子的值哈希
+}
+
+// ProofEntry 多键证明中的一项
+// 生成证明时由 GenerateMultiProof 返回，验证时由验证者提供自己期望的结果
+type ProofEntry struct {
+	Key    []byte // 原始键
+	Value  []byte // 键对应的值（Exists 为 false 时忽略）
+	Exists bool   // 该键是否存在于树中
+}
+
+// GenerateMultiProof 为多个键生成一个多键证明
+// 参数:
+//   keys: 要证明的键（顺序任意，重复的键只证明一次）
+// 返回:
+//   proof: 覆盖所有键的多键证明
+//   entries: 与 keys 顺序一致的查询结果（值以及是否存在），可以直接交给验证者
+//   err: 使用节点存储时，加载节点失败的错误
+// 工作原理:
+//   把键哈希排序后从根节点开始递归，在每一层按比特位把键分成左右两组
+func (smt *SparseMerkleTree) GenerateMultiProof(keys [][]byte) (*MultiProof, []ProofEntry, error) {
+	root := smt.currentRoot() // 所有查询和证明都针对同一个根
+	entries := make([]ProofEntry, len(keys))
+	hashes := make([][]byte, 0, len(keys))
+	for i, key := range keys {
+		if err := smt.checkKey(key, smt.depth); err != nil {
+			return nil, nil, err
+		}
+		keyHash := smt.hashKey(key)
+		value, found, err := smt.get(root, keyHash, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries[i] = ProofEntry{Key: key, Value: value, Exists: found}
+		hashes = append(hashes, keyHash)
+	}
+	hashes = sortUniqueHashes(hashes)
+
+	proof := &MultiProof{Depth: smt.depth}
+	if len(hashes) > 0 {
+		if err := smt.generateMultiProof(root, hashes, 0, proof); err != nil {
+			return nil, nil, err
+		}
+	}
+	return proof, entries, nil
+}
+
+// generateMultiProof 递归生成多键证明
+// 参数:
+//   node: 当前处理的节点
+//   group: 落在该子树中的键哈希（已排序、非空）
+//   depth: 当前深度
+//   proof: 正在构建的证明
+// 返回:
+//   加载节点失败时的错误
+func (smt *SparseMerkleTree) generateMultiProof(node *Node, group [][]byte, depth int, proof *MultiProof) error {
+	node, err := smt.load(node, depth)
+	if err != nil {
+		return err
+	}
+
+	// 终点：空子树或叶子（捷径模式下叶子可能在任意一层）
+	if node == nil || node.key != nil {
+		proof.Terminals = append(proof.Terminals, true)
+		leaf := MultiProofLeaf{}
+		if node != nil {
+			leaf.Key = node.key
+			leaf.ValueHash = smt.hashValue(node.value)
+		}
+		proof.Leaves = append(proof.Leaves, leaf)
+		return nil
+	}
+
+	proof.Terminals = append(proof.Terminals, false)
+	left, right := splitByBit(group, depth)
+	if len(left) > 0 {
+		if err := smt.generateMultiProof(node.left, left, depth+1, proof); err != nil {
+			return err
+		}
+	} else {
+		proof.Siblings = append(proof.Siblings, siblingHash(node.left))
+	}
+	if len(right) > 0 {
+		return smt.generateMultiProof(node.right, right, depth+1, proof)
+	}
+	proof.Siblings = append(proof.Siblings, siblingHash(node.right))
+	return nil
+}
+
+// VerifyMultiProof 验证多键证明
+// 这是包级函数 VerifyMultiProof 的便捷封装，使用树的当前根哈希
+func (smt *SparseMerkleTree) VerifyMultiProof(entries []ProofEntry, proof *MultiProof) bool {
+	if proof == nil || proof.Depth != smt.depth {
+		return false
+	}
+	return smt.verifyMultiProof(smt.GetRoot(), entries, proof)
+}
+
+// VerifyMultiProof 无状态地验证多键证明
+// 参数:
+//   root: 验证者信任的根哈希
+//   entries: 期望的结果，每一项声明一个键存在（及其值）或不存在
+//   proof: 由 GenerateMultiProof 生成的多键证明
+//   opts: 生成证明的树所使用的配置（例如 WithHasher），必须与树一致
+// 返回:
+//   true 表示所有声明都成立，false 表示证明无效或任意一项声明不成立
+// 工作原理:
+//   按与生成时相同的规则把键分组并遍历证明，重建剪枝子树的根哈希：
+//   终点处检查组内每个键的声明，非终点处合并左右子树的哈希，最后与 root 比较
+// 注意:
+//   旧布局（WithLegacyHashing）下深度小于键哈希的比特数时，叶子的键不受根哈希约束（见 bindsLeafKey），
+//   终点是叶子时组内的键都必须就是该叶子的键，声明不存在的键只能由空子树证明
+func VerifyMultiProof(root []byte, entries []ProofEntry, proof *MultiProof, opts ...Option) bool {
+	c := newTreeConfig(opts)
+	return c.verifyMultiProof(root, entries, proof)
+}
+
+// multiProofClaim 验证时一个键的声明（键已哈希）
+type multiProofClaim struct {
+	keyHash   []byte // 键哈希
+	valueHash []byte // 值哈希（不存在时为 nil）
+	exists    bool   // 是否声明存在
+}
+
+// verifyMultiProof 使用给定配置验证多键证明，是 VerifyMultiProof 的内部实现
+func (c *treeConfig) verifyMultiProof(root []byte, entries []ProofEntry, proof *MultiProof) bool {
+	if proof == nil || len(entries) == 0 || !c.validDepth(proof.Depth) {
+		return false
+	}
+
+	// 把声明按键哈希排序；同一个键出现多次时，声明必须一致
+	claims := make([]multiProofClaim, 0, len(entries))
+	for _, e := range entries {
+		if c.checkKey(e.Key, proof.Depth) != nil {
+			return false
+		}
+		claim := multiProofClaim{keyHash: c.hashKey(e.Key), exists: e.Exists}
+		if e.Exists {
+			claim.valueHash = c.hashValue(e.Value)
+		}
+		claims = append(claims, claim)
+	}
+	sort.Slice(claims, func(i, j int) bool {
+		return bytes.Compare(claims[i].keyHash, claims[j].keyHash) < 0
+	})
+	unique := claims[:1]
+	for _, claim := range claims[1:] {
+		last := unique[len(unique)-1]
+		if !bytes.Equal(last.keyHash, claim.keyHash) {
+			unique = append(unique, claim)
+			continue
+		}
+		if last.exists != claim.exists || !bytes.Equal(last.valueHash, claim.valueHash) {
+			return false
+		}
+	}
+
+	v := &multiProofVerifier{
+		treeConfig: c,
+		proof:      proof,
+		defaults:   c.defaultHashes(proof.Depth),
+	}
+	hash, ok := v.walk(unique, 0)
+	if !ok {
+		return false
+	}
+	// 证明中的所有内容都必须被用到，不允许夹带多余的数据
+	if v.terminals != len(proof.Terminals) || v.leaves != len(proof.Leaves) || v.siblings != len(proof.Siblings) {
+		return false
+	}
+	return bytes.Equal(hash, root)
+}
+
+// multiProofVerifier 多键证明的验证状态
+type multiProofVerifier struct {
+	*treeConfig
+	proof     *MultiProof
+	defaults  [][]byte // 默认哈希表
+	terminals int      // 已读取的 Terminals 数量
+	leaves    int      // 已读取的 Leaves 数量
+	siblings  int      // 已读取的 Siblings 数量
+}
+
+// walk 重建第 depth 层、包含 group 中所有键的子树的哈希
+// 返回子树哈希；证明格式错误或声明不成立时 ok 为 false
+func (v *multiProofVerifier) walk(group []multiProofClaim, depth int) ([]byte, bool) {
+	if v.terminals >= len(v.proof.Terminals) {
+		return nil, false
+	}
+	terminal := v.proof.Terminals[v.terminals]
+	v.terminals++
+
+	if terminal {
+		if v.leaves >= len(v.proof.Leaves) {
+			return nil, false
+		}
+		leaf := v.proof.Leaves[v.leaves]
+		v.leaves++
+		return v.checkTerminal(group, leaf, depth)
+	}
+
+	// 非终点：按比特位把键分成左右两组
+	if depth >= v.proof.Depth {
+		return nil, false
+	}
+	split := sort.Search(len(group), func(i int) bool {
+		return getBit(group[i].keyHash, depth)
+	})
+	left, right := group[:split], group[split:]
+
+	leftHash, ok := v.child(left, depth+1)
+	if !ok {
+		return nil, false
+	}
+	rightHash, ok := v.child(right, depth+1)
+	if !ok {
+		return nil, false
+	}
+	return v.hashNodes(leftHash, rightHash), true
+}
+
+// child 获取第 depth 层的一个子树的哈希：有被证明的键时继续遍历，否则读取兄弟哈希
+func (v *multiProofVerifier) child(group []multiProofClaim, depth int) ([]byte, bool) {
+	if len(group) > 0 {
+		return v.walk(group, depth)
+	}
+	if v.siblings >= len(v.proof.Siblings) {
+		return nil, false
+	}
+	sibling := v.proof.Siblings[v.siblings]
+	v.siblings++
+	if sibling == nil {
+		return v.defaults[v.proof.Depth-depth], true
+	}
+	return sibling, true
+}
+
+// checkTerminal 检查终点处的声明，并返回终点子树的哈希
+func (v *multiProofVerifier) checkTerminal(group []multiProofClaim, leaf MultiProofLeaf, depth int) ([]byte, bool) {
+	// 空子树：组内所有键都必须声明为不存在
+	if leaf.Key == nil {
+		for _, claim := range group {
+			if claim.exists {
+				return nil, false
+			}
+		}
+		return v.defaults[v.proof.Depth-depth], true
+	}
+
+	// 叶子必须与组内的键处在同一条路径上
+	if commonPrefix(leaf.Key, group[0].keyHash, depth) != depth {
+		return nil, false
+	}
+	for _, claim := range group {
+		same := bytes.Equal(claim.keyHash, leaf.Key)
+		if !same && !v.bindsLeafKey(v.proof.Depth, claim.keyHash) {
+			return nil, false // leaf.Key 不受根哈希约束，不能用来证明其他键不存在
+		}
+		if claim.exists != same {
+			return nil, false
+		}
+		if same && !bytes.Equal(claim.valueHash, leaf.ValueHash) {
+			return nil, false
+		}
+	}
+	leafHash := v.hashLeaf(leaf.Key, leaf.ValueHash)
+	return v.foldLeaf(leaf.Key, leafHash, depth, v.proof.Depth, v.defaults), true
+}
+
+// sortUniqueHashes 对键哈希排序并去重
+func sortUniqueHashes(hashes [][]byte) [][]byte {
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i], hashes[j]) < 0
+	})
+	unique := hashes[:0]
+	for _, h := range hashes {
+		if len(unique) == 0 || !bytes.Equal(h, unique[len(unique)-1]) {
+			unique = append(unique, h)
+		}
+	}
+	return unique
+}
+
+// splitByBit 把已排序的键哈希按第 depth 个比特位分成左右两组
+// 由于键哈希已按字节序排序，同一前缀下比特位为 0 的键总是排在前面
+func splitByBit(group [][]byte, depth int) (left, right [][]byte) {
+	split := sort.Search(len(group), func(i int) bool {
+		return getBit(group[i], depth)
+	})
+	return group[:split], group[split:]
+}
@@ -0,0 +1,147 @@
+package exercise
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestVerifyMultiProof(t *testing.T) {
+	modes := []struct {
+		name  string
+		depth int
+		opts  []Option
+	}{
+		{"default", 256, nil},
+		{"shortcut", 256, []Option{WithShortcutLeaves()}},
+		{"shallow", 8, nil},
+		{"sha3", 256, []Option{WithHasher(SHA3_256Hasher), WithShortcutLeaves()}},
+	}
+	queries := []struct {
+		name string
+		keys []string
+	}{
+		{"present", []string{"account1", "account2", "account30"}},
+		{"absent", []string{"nobody", "somebody"}},
+		{"mixed", []string{"account7", "nobody", "account19"}},
+		{"duplicates", []string{"account3", "account3", "nobody", "nobody"}},
+		{"single", []string{"account0"}},
+		{"none", nil},
+	}
+	for _, m := range modes {
+		tree := NewSparseMerkleTree(m.depth, m.opts...)
+		for i := 0; i < 20; i++ {
+			if err := tree.Update([]byte(fmt.Sprintf("account%d", i)), []byte(fmt.Sprint(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root := tree.GetRoot()
+		for _, q := range queries {
+			t.Run(m.name+"/"+q.name, func(t *testing.T) {
+				keys := make([][]byte, len(q.keys))
+				for i, k := range q.keys {
+					keys[i] = []byte(k)
+				}
+				proof, entries, err := tree.GenerateMultiProof(keys)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i, e := range entries {
+					value, found, _ := tree.Get(keys[i])
+					if !bytes.Equal(e.Key, keys[i]) || e.Exists != found || !bytes.Equal(e.Value, value) {
+						t.Errorf("entry %d: got %+v", i, e)
+					}
+				}
+				if len(entries) == 0 {
+					// 没有任何声明的证明什么也没有证明，验证总是失败
+					if VerifyMultiProof(root, entries, proof, m.opts...) {
+						t.Error("empty multiproof verifies")
+					}
+					return
+				}
+				if !VerifyMultiProof(root, entries, proof, m.opts...) || !tree.VerifyMultiProof(entries, proof) {
+					t.Fatal("multiproof does not verify")
+				}
+
+				// 任何一项被篡改都必须被发现
+				for i := range entries {
+					flipped := append([]ProofEntry(nil), entries...)
+					flipped[i].Exists = !flipped[i].Exists
+					if flipped[i].Exists {
+						flipped[i].Value = []byte("forged")
+					}
+					if VerifyMultiProof(root, flipped, proof, m.opts...) {
+						t.Errorf("proof verifies with entry %d flipped", i)
+					}
+					if entries[i].Exists {
+						changed := append([]ProofEntry(nil), entries...)
+						changed[i].Value = []byte("forged")
+						if VerifyMultiProof(root, changed, proof, m.opts...) {
+							t.Errorf("proof verifies with entry %d changed", i)
+						}
+					}
+				}
+				// 证明不能用来证明它没有覆盖的键
+				extra := append(entries[:len(entries):len(entries)], ProofEntry{Key: []byte("account11"), Value: []byte("11"), Exists: true})
+				if VerifyMultiProof(root, extra, proof, m.opts...) {
+					t.Error("proof verifies an entry it does not cover")
+				}
+			})
+		}
+	}
+}
+
+// TestMultiProofSharesSiblings 多键证明中共享的上层兄弟节点只出现一次
+func TestMultiProofSharesSiblings(t *testing.T) {
+	tree := NewSparseMerkleTree(256, WithShortcutLeaves())
+	var keys [][]byte
+	for i := 0; i < 64; i++ {
+		key := []byte(fmt.Sprintf("account%d", i))
+		keys = append(keys, key)
+		if err := tree.Update(key, []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	multi, _, err := tree.GenerateMultiProof(keys[:8])
+	if err != nil {
+		t.Fatal(err)
+	}
+	separate := 0
+	for _, key := range keys[:8] {
+		p, err := tree.GenerateProof(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		separate += len(p.Siblings)
+	}
+	if len(multi.Siblings) >= separate {
+		t.Errorf("multiproof has %d siblings, separate proofs %d", len(multi.Siblings), separate)
+	}
+}
+
+func TestVerifyMultiProofMalformed(t *testing.T) {
+	tree := NewSparseMerkleTree(256)
+	if err := tree.Update([]byte("alice"), []byte("100")); err != nil {
+		t.Fatal(err)
+	}
+	proof, entries, err := tree.GenerateMultiProof([][]byte{[]byte("alice")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		proof *MultiProof
+	}{
+		{"nil", nil},
+		{"bad depth", &MultiProof{Depth: 1000}},
+		{"truncated", &MultiProof{Depth: 256, Terminals: proof.Terminals[:1], Leaves: proof.Leaves, Siblings: proof.Siblings}},
+		{"extra leaf", &MultiProof{Depth: 256, Terminals: proof.Terminals, Leaves: append(append([]MultiProofLeaf(nil), proof.Leaves...), MultiProofLeaf{}), Siblings: proof.Siblings}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if VerifyMultiProof(tree.GetRoot(), entries, tt.proof) {
+				t.Error("malformed proof verifies")
+			}
+		})
+	}
+}
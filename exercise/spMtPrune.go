@@ -0,0 +1,168 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrStoreNotPrunable 节点存储不支持回收节点
+var ErrStoreNotPrunable = errors.New("smt: node store does not support pruning")
+
+// PrunableNodeStore 支持回收节点的节点存储
+// MemoryNodeStore 和 FileNodeStore 都实现了这个接口
+type PrunableNodeStore interface {
+	NodeStore
+	// Sweep 删除 live 返回 false 的所有节点，返回删除的节点数和字节数（哈希加节点编码）
+	// 执行期间可能有并发的 Get，但不会有并发的 Put
+	Sweep(live func(hash []byte) bool) (nodes int, bytes int64, err error)
+}
+
+// PruneStats 一次剪除的结果
+type PruneStats struct {
+	Versions int   // 丢弃的版本数
+	Nodes    int   // 回收的节点数
+	Bytes    int64 // 回收的字节数（节点哈希加节点编码）
+}
+
+// PruneVersions 只保留最近的 keep 个版本，回收其余版本独有的节点
+// 参数:
+//   keep: 要保留的版本数，小于等于 0 时丢弃所有已提交版本
+// 返回:
+//   剪除的统计结果；见 PruneRoots 的说明
+func (smt *SparseMerkleTree) PruneVersions(keep int) (PruneStats, error) {
+	// 版本数必须在 prune 持有锁之后读取，否则并发的 Commit 会使保留的版本数不对
+	return smt.prune(func(i, n int, _ []byte) bool { return i >= n-max(keep, 0) }, nil)
+}
+
+// PruneRoots 只保留根哈希在 roots 中的版本，回收所有从这些根都无法到达的节点
+// 参数:
+//   roots: 要保留的根哈希；不属于任何版本的根（例如共享同一个存储的其他树的根）同样会被保留
+// 返回:
+//   剪除的统计结果
+// 工作原理（标记-清除）:
+//   1. 从所有保留的根出发遍历，标记可以到达的节点；当前（可能未提交）的根，
+//      以及预写日志中最近一次提交的根总是被保留
+//   2. 丢弃未被保留的版本
+//   3. 使用节点存储时，删除存储中所有未被标记的节点，包括崩溃时遗留的孤立节点；
+//      不使用节点存储时，节点由 Go 的垃圾回收器释放，这里只统计被丢弃版本独有的节点
+// 注意:
+//   - 保留版本的节点不会被删除，因此其他 goroutine 可以在剪除的同时读取保留版本的快照
+//   - 被丢弃版本的快照在使用节点存储时不能再使用
+//   - 存储必须只被这棵树使用，否则其他树的根需要通过 roots 一并保留
+func (smt *SparseMerkleTree) PruneRoots(roots [][]byte) (PruneStats, error) {
+	retain := make(map[string]bool, len(roots))
+	for _, root := range roots {
+		retain[string(root)] = true
+	}
+	return smt.prune(func(_, _ int, root []byte) bool { return retain[string(root)] }, roots)
+}
+
+// prune 剪除的内部实现
+// 参数:
+//   retain: 判断 n 个已提交版本中的第 i 个（根哈希为 root）是否保留，在持有写锁时调用
+//   extra: 除保留版本之外，还需要保留的根哈希
+func (smt *SparseMerkleTree) prune(retain func(i, n int, root []byte) bool, extra [][]byte) (PruneStats, error) {
+	smt.mu.Lock()
+	defer smt.mu.Unlock()
+	var store PrunableNodeStore
+	if smt.store != nil {
+		s, ok := smt.store.(PrunableNodeStore)
+		if !ok {
+			return PruneStats{}, ErrStoreNotPrunable
+		}
+		store = s
+	}
+
+	var kept, dropped []committedVersion
+	for i, v := range smt.versions {
+		if retain(i, len(smt.versions), smt.hashOf(v.root, 0)) {
+			kept = append(kept, v)
+		} else {
+			dropped = append(dropped, v)
+		}
+	}
+
+	// 需要保留的所有根
+	live := []*Node{smt.root}
+	for _, v := range kept {
+		live = append(live, v.root)
+	}
+	if store != nil {
+		if smt.journal != nil {
+			extra = append(extra, smt.journal.committed)
+		}
+		for _, root := range extra {
+			if root != nil && !bytes.Equal(root, smt.defaults[smt.depth]) {
+				live = append(live, stubNode(root))
+			}
+		}
+	}
+
+	stats := PruneStats{Versions: len(dropped)}
+	if store == nil {
+		// 只在内存中：统计从被丢弃的版本可以到达、但从保留的根无法到达的节点
+		marked := make(map[*Node]bool)
+		for _, root := range live {
+			markNodes(root, marked)
+		}
+		for _, v := range dropped {
+			smt.countUnmarked(v.root, marked, &stats)
+		}
+		smt.versions = kept
+		return stats, nil
+	}
+
+	// 先完成标记（可能因为加载失败而出错），出错时树保持不变
+	marked := make(map[string]bool)
+	for _, root := range live {
+		if err := smt.markStored(root, 0, marked); err != nil {
+			return PruneStats{}, err
+		}
+	}
+	smt.versions = kept
+	nodes, freed, err := store.Sweep(func(hash []byte) bool { return marked[string(hash)] })
+	stats.Nodes, stats.Bytes = nodes, freed
+	return stats, err
+}
+
+// markNodes 标记从 node 可以到达的所有内存节点
+func markNodes(node *Node, marked map[*Node]bool) {
+	if node == nil || marked[node] {
+		return
+	}
+	marked[node] = true
+	markNodes(node.left, marked)
+	markNodes(node.right, marked)
+}
+
+// countUnmarked 统计从 node 可以到达、且没有被标记的节点，统计过的节点随即被标记以免重复计算
+func (smt *SparseMerkleTree) countUnmarked(node *Node, marked map[*Node]bool, stats *PruneStats) {
+	if node == nil || marked[node] {
+		return
+	}
+	marked[node] = true
+	stats.Nodes++
+	stats.Bytes += int64(len(node.hash))
+	if !node.lazy {
+		stats.Bytes += int64(len(smt.encodeNode(node)))
+	}
+	smt.countUnmarked(node.left, marked, stats)
+	smt.countUnmarked(node.right, marked, stats)
+}
+
+// markStored 按哈希标记从 node 可以到达的所有节点（按需从存储加载）
+// 已标记的哈希说明整棵子树都已标记，直接跳过，因此多个版本共享的子树只遍历一次
+func (smt *SparseMerkleTree) markStored(node *Node, depth int, marked map[string]bool) error {
+	if node == nil || marked[string(node.hash)] {
+		return nil
+	}
+	marked[string(node.hash)] = true
+	node, err := smt.load(node, depth)
+	if err != nil || node.key != nil {
+		return err
+	}
+	if err := smt.markStored(node.left, depth+1, marked); err != nil {
+		return err
+	}
+	return smt.markStored(node.right, depth+1, marked)
+}
@@ -0,0 +1,144 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// newHistoryTree 返回提交了 versions 个版本的树，第 h 个版本中 account<i> 的值为 h*i
+func newHistoryTree(t *testing.T, versions int, opts ...Option) *SparseMerkleTree {
+	t.Helper()
+	tree := NewSparseMerkleTree(256, append([]Option{WithShortcutLeaves()}, opts...)...)
+	for h := 1; h <= versions; h++ {
+		for i := 0; i < 20; i++ {
+			if err := tree.Update([]byte(fmt.Sprintf("account%d", i)), []byte(fmt.Sprint(h*i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := tree.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tree
+}
+
+// checkVersion 检查版本 h 中的值
+func checkVersion(t *testing.T, tree *SparseMerkleTree, h Version) {
+	t.Helper()
+	snap, err := tree.At(h)
+	if err != nil {
+		t.Fatalf("version %d: %v", h, err)
+	}
+	for i := 0; i < 20; i++ {
+		value, found, err := snap.Get([]byte(fmt.Sprintf("account%d", i)))
+		if err != nil || !found || string(value) != fmt.Sprint(int(h)*i) {
+			t.Fatalf("version %d, account%d: got %q (found=%v, err=%v)", h, i, value, found, err)
+		}
+	}
+}
+
+func TestPruneVersions(t *testing.T) {
+	stores := []struct {
+		name  string
+		store func(t *testing.T) NodeStore
+	}{
+		{"memory", func(*testing.T) NodeStore { return nil }},
+		{"memory store", func(*testing.T) NodeStore { return NewMemoryNodeStore() }},
+		{"file store", func(t *testing.T) NodeStore {
+			s, err := OpenFileNodeStore(filepath.Join(t.TempDir(), "nodes"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		}},
+	}
+	keeps := []struct {
+		keep    int
+		dropped int
+	}{
+		{keep: 3, dropped: 7},
+		{keep: 10, dropped: 0},
+		{keep: 20, dropped: 0},
+		{keep: 0, dropped: 10},
+	}
+	for _, s := range stores {
+		for _, k := range keeps {
+			t.Run(fmt.Sprintf("%s/keep %d", s.name, k.keep), func(t *testing.T) {
+				var opts []Option
+				if store := s.store(t); store != nil {
+					opts = append(opts, WithNodeStore(store))
+				}
+				tree := newHistoryTree(t, 10, opts...)
+				root := tree.GetRoot()
+
+				stats, err := tree.PruneVersions(k.keep)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stats.Versions != k.dropped {
+					t.Errorf("dropped %d versions, want %d", stats.Versions, k.dropped)
+				}
+				if k.dropped > 0 && (stats.Nodes == 0 || stats.Bytes == 0) {
+					t.Errorf("dropping %d versions freed %d nodes, %d bytes", k.dropped, stats.Nodes, stats.Bytes)
+				}
+				for h := Version(1); h <= 10; h++ {
+					if h <= Version(k.dropped) {
+						if _, err := tree.At(h); !errors.Is(err, ErrUnknownVersion) {
+							t.Errorf("dropped version %d: got %v, want ErrUnknownVersion", h, err)
+						}
+						continue
+					}
+					checkVersion(t, tree, h)
+				}
+				// 当前根总是保留，即使它不属于任何保留的版本
+				value, found, err := tree.Get([]byte("account7"))
+				if err != nil || !found || string(value) != "70" {
+					t.Errorf("current account7: got %q (found=%v, err=%v)", value, found, err)
+				}
+				if !bytes.Equal(tree.GetRoot(), root) {
+					t.Error("pruning changed the current root")
+				}
+			})
+		}
+	}
+}
+
+func TestPruneRoots(t *testing.T) {
+	store := NewMemoryNodeStore()
+	tree := newHistoryTree(t, 5, WithNodeStore(store))
+	second, err := tree.At(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := tree.PruneRoots([][]byte{second.GetRoot()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Versions != 4 {
+		t.Errorf("dropped %d versions, want 4", stats.Versions)
+	}
+	checkVersion(t, tree, 2)
+	if _, err := tree.At(5); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("version 5: got %v, want ErrUnknownVersion", err)
+	}
+	// 第 5 个版本的根就是当前根，它的节点仍然保留
+	value, found, err := tree.Get([]byte("account7"))
+	if err != nil || !found || string(value) != "35" {
+		t.Errorf("current account7: got %q (found=%v, err=%v)", value, found, err)
+	}
+}
+
+func TestPruneNotPrunable(t *testing.T) {
+	store := &countingStore{NodeStore: NewMemoryNodeStore()}
+	tree := newHistoryTree(t, 2, WithNodeStore(store))
+	if _, err := tree.PruneVersions(1); !errors.Is(err, ErrStoreNotPrunable) {
+		t.Fatalf("got %v, want ErrStoreNotPrunable", err)
+	}
+	// 出错时树保持不变
+	checkVersion(t, tree, 1)
+}
@@ -0,0 +1,263 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrInvalidRange 区间或前缀不合法（长度与键不一致，或起点大于终点）
+var ErrInvalidRange = errors.New("smt: invalid key range")
+
+// GenerateRangeProof 生成区间证明：证明闭区间 [start, end] 中恰好有哪些键
+// 区间为空时就是"start 与 end 之间不存在任何键"的证明
+// 参数:
+//   start, end: 区间的起点和终点（包含），长度必须与键哈希相同；
+//               原始键模式（见 WithRawKeys）下就是键本身，否则是键哈希空间中的区间
+// 返回:
+//   proof: 区间证明，格式与多键证明相同
+//   leaves: 区间中的所有叶子，按键的顺序排列，可以直接交给验证者
+//   err: 区间不合法时返回 ErrInvalidRange；使用节点存储时，加载节点失败的错误
+// 工作原理:
+//   从根节点开始，只进入与区间相交的子树，与区间不相交的子树只记录哈希；
+//   相交子树中的每个终点（空子树或叶子）都会出现在证明中，因此区间中的叶子一个也无法隐藏
+func (smt *SparseMerkleTree) GenerateRangeProof(start, end []byte) (*MultiProof, []Leaf, error) {
+	size := smt.keySize(smt.depth)
+	if len(start) != size || len(end) != size || bytes.Compare(start, end) > 0 {
+		return nil, nil, ErrInvalidRange
+	}
+	g := &rangeGenerator{tree: smt, start: start, end: end, proof: &MultiProof{Depth: smt.depth}}
+	if err := g.walk(smt.currentRoot(), 0, make([]byte, size)); err != nil {
+		return nil, nil, err
+	}
+	return g.proof, g.leaves, nil
+}
+
+// GeneratePrefixProof 生成前缀证明：证明以 prefix 开头的键恰好有哪些
+// 相当于以 prefix||00..00 和 prefix||ff..ff 为端点的区间证明（见 GenerateRangeProof）
+// 参数:
+//   prefix: 键（或键哈希）的字节前缀，长度不能超过键的长度
+func (smt *SparseMerkleTree) GeneratePrefixProof(prefix []byte) (*MultiProof, []Leaf, error) {
+	start, end, err := prefixRange(prefix, smt.keySize(smt.depth))
+	if err != nil {
+		return nil, nil, err
+	}
+	return smt.GenerateRangeProof(start, end)
+}
+
+// VerifyRangeProof 无状态地验证区间证明
+// 参数:
+//   root: 验证者信任的根哈希
+//   start, end: 区间的起点和终点（包含）
+//   leaves: 声明的区间中的所有叶子，必须按键的顺序排列
+//   proof: 由 GenerateRangeProof 生成的证明
+//   opts: 生成证明的树所使用的配置（例如 WithRawKeys、WithHasher），必须与树一致
+// 返回:
+//   true 表示 root 对应的树在区间中恰好包含 leaves 这些键值对，不多也不少
+// 工作原理:
+//   验证者根据区间自己决定遍历哪些子树：与区间相交的子树必须在证明中展开到终点，
+//   不相交的子树才从证明中读取兄弟哈希；落在区间中的每个叶子都必须与 leaves 中的下一项一致
+// 注意:
+//   旧布局（WithLegacyHashing）下深度小于键的比特数时，叶子的键不受根哈希约束（见 bindsLeafKey），
+//   区间外的叶子可能是被隐瞒的区间内的键，因此证明中出现区间外的叶子时总是被拒绝
+func VerifyRangeProof(root, start, end []byte, leaves []Leaf, proof *MultiProof, opts ...Option) bool {
+	c := newTreeConfig(opts)
+	return c.verifyRangeProof(root, start, end, leaves, proof)
+}
+
+// VerifyPrefixProof 无状态地验证前缀证明，见 VerifyRangeProof
+func VerifyPrefixProof(root, prefix []byte, leaves []Leaf, proof *MultiProof, opts ...Option) bool {
+	c := newTreeConfig(opts)
+	if proof == nil || !c.validDepth(proof.Depth) {
+		return false
+	}
+	start, end, err := prefixRange(prefix, c.keySize(proof.Depth))
+	if err != nil {
+		return false
+	}
+	return c.verifyRangeProof(root, start, end, leaves, proof)
+}
+
+// prefixRange 把前缀转换为闭区间 [prefix||00..00, prefix||ff..ff]
+func prefixRange(prefix []byte, size int) (start, end []byte, err error) {
+	if len(prefix) > size {
+		return nil, nil, ErrInvalidRange
+	}
+	start = make([]byte, size)
+	end = bytes.Repeat([]byte{0xFF}, size)
+	copy(start, prefix)
+	copy(end, prefix)
+	return start, end, nil
+}
+
+// verifyRangeProof 使用给定配置验证区间证明，是 VerifyRangeProof 的内部实现
+func (c *treeConfig) verifyRangeProof(root, start, end []byte, leaves []Leaf, proof *MultiProof) bool {
+	if proof == nil || !c.validDepth(proof.Depth) {
+		return false
+	}
+	size := c.keySize(proof.Depth)
+	if len(start) != size || len(end) != size || bytes.Compare(start, end) > 0 {
+		return false
+	}
+	v := &rangeVerifier{
+		multiProofVerifier: &multiProofVerifier{
+			treeConfig: c,
+			proof:      proof,
+			defaults:   c.defaultHashes(proof.Depth),
+		},
+		start:  start,
+		end:    end,
+		claims: leaves,
+	}
+	hash, ok := v.walk(0, make([]byte, size))
+	if !ok || v.next != len(leaves) {
+		return false
+	}
+	// 证明中的所有内容都必须被用到，不允许夹带多余的数据
+	if v.terminals != len(proof.Terminals) || v.leaves != len(proof.Leaves) || v.siblings != len(proof.Siblings) {
+		return false
+	}
+	return bytes.Equal(hash, root)
+}
+
+// rangeGenerator 生成区间证明时的状态
+type rangeGenerator struct {
+	tree       *SparseMerkleTree
+	start, end []byte      // 区间
+	proof      *MultiProof // 正在构建的证明
+	leaves     []Leaf      // 区间中的叶子
+}
+
+// walk 展开与区间相交的子树 node
+// 参数:
+//   node: 当前节点
+//   depth: 当前深度
+//   path: 前 depth 位为当前节点路径的任意键（其余位为 0）
+func (g *rangeGenerator) walk(node *Node, depth int, path []byte) error {
+	node, err := g.tree.load(node, depth)
+	if err != nil {
+		return err
+	}
+	if node == nil || node.key != nil {
+		g.proof.Terminals = append(g.proof.Terminals, true)
+		leaf := MultiProofLeaf{}
+		if node != nil {
+			leaf.Key = node.key
+			leaf.ValueHash = g.tree.hashValue(node.value)
+			if inRange(node.key, g.start, g.end) {
+				g.leaves = append(g.leaves, Leaf{KeyHash: node.key, Value: node.value})
+			}
+		}
+		g.proof.Leaves = append(g.proof.Leaves, leaf)
+		return nil
+	}
+
+	g.proof.Terminals = append(g.proof.Terminals, false)
+	for i, child := range []*Node{node.left, node.right} {
+		childPath := withBit(path, depth, i == 1)
+		if !overlaps(childPath, depth+1, g.start, g.end) {
+			g.proof.Siblings = append(g.proof.Siblings, siblingHash(child))
+			continue
+		}
+		if err := g.walk(child, depth+1, childPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeVerifier 区间证明的验证状态
+type rangeVerifier struct {
+	*multiProofVerifier
+	start, end []byte // 区间
+	claims     []Leaf // 声明的区间中的叶子
+	next       int    // 下一个应当出现的声明
+}
+
+// walk 重建与区间相交的子树的哈希，参数与 rangeGenerator.walk 相同
+// 返回子树哈希；证明格式错误、区间中的叶子与声明不一致时 ok 为 false
+func (v *rangeVerifier) walk(depth int, path []byte) ([]byte, bool) {
+	if v.terminals >= len(v.proof.Terminals) {
+		return nil, false
+	}
+	terminal := v.proof.Terminals[v.terminals]
+	v.terminals++
+
+	if terminal {
+		if v.leaves >= len(v.proof.Leaves) {
+			return nil, false
+		}
+		leaf := v.proof.Leaves[v.leaves]
+		v.leaves++
+		return v.checkRangeTerminal(leaf, depth, path)
+	}
+
+	if depth >= v.proof.Depth {
+		return nil, false
+	}
+	var hashes [2][]byte
+	for i := range hashes {
+		childPath := withBit(path, depth, i == 1)
+		var ok bool
+		if overlaps(childPath, depth+1, v.start, v.end) {
+			hashes[i], ok = v.walk(depth+1, childPath)
+		} else {
+			hashes[i], ok = v.child(nil, depth+1)
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	return v.hashNodes(hashes[0], hashes[1]), true
+}
+
+// checkRangeTerminal 检查终点，并返回终点子树的哈希
+// 叶子必须位于当前子树中；叶子落在区间中时，必须与下一个声明一致
+func (v *rangeVerifier) checkRangeTerminal(leaf MultiProofLeaf, depth int, path []byte) ([]byte, bool) {
+	if leaf.Key == nil {
+		return v.defaults[v.proof.Depth-depth], true
+	}
+	if len(leaf.Key) != len(path) || commonPrefix(leaf.Key, path, depth) != depth {
+		return nil, false
+	}
+	if inRange(leaf.Key, v.start, v.end) {
+		if v.next >= len(v.claims) {
+			return nil, false
+		}
+		claim := v.claims[v.next]
+		v.next++
+		if !bytes.Equal(claim.KeyHash, leaf.Key) || !bytes.Equal(v.hashValue(claim.Value), leaf.ValueHash) {
+			return nil, false
+		}
+	} else if !v.bindsLeafKey(v.proof.Depth, path) {
+		return nil, false // leaf.Key 不受根哈希约束，不能证明它在区间之外
+	}
+	leafHash := v.hashLeaf(leaf.Key, leaf.ValueHash)
+	return v.foldLeaf(leaf.Key, leafHash, depth, v.proof.Depth, v.defaults), true
+}
+
+// withBit 返回把 path 的第 depth 位设为 bit 之后的副本
+func withBit(path []byte, depth int, bit bool) []byte {
+	p := bytes.Clone(path)
+	if bit {
+		p[depth/8] |= 0x80 >> (depth % 8)
+	} else {
+		p[depth/8] &^= 0x80 >> (depth % 8)
+	}
+	return p
+}
+
+// overlaps 判断路径前 depth 位为 path 的子树是否与闭区间 [start, end] 相交
+// 子树中最小的键是 path 的其余位全为 0，最大的键是其余位全为 1
+func overlaps(path []byte, depth int, start, end []byte) bool {
+	lo, hi := bytes.Clone(path), bytes.Clone(path)
+	for i := depth; i < len(path)*8; i++ {
+		lo[i/8] &^= 0x80 >> (i % 8)
+		hi[i/8] |= 0x80 >> (i % 8)
+	}
+	return bytes.Compare(lo, end) <= 0 && bytes.Compare(hi, start) >= 0
+}
+
+// inRange 判断键是否落在闭区间 [start, end] 中
+func inRange(key, start, end []byte) bool {
+	return bytes.Compare(key, start) >= 0 && bytes.Compare(key, end) <= 0
+}
@@ -0,0 +1,135 @@
+package exercise
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// height 把区块高度编码为原始键
+func height(h uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, h)
+}
+
+// newBlockTree 返回以区块高度为原始键的树
+func newBlockTree(t *testing.T, heights ...uint64) *SparseMerkleTree {
+	t.Helper()
+	tree := NewSparseMerkleTree(64, WithRawKeys(), WithShortcutLeaves())
+	for _, h := range heights {
+		if err := tree.Update(height(h), []byte(fmt.Sprintf("block-%d", h))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tree
+}
+
+func TestRangeProof(t *testing.T) {
+	tree := newBlockTree(t, 100, 101, 102, 200, 201, 0x1_0000)
+	root := tree.GetRoot()
+	opts := []Option{WithRawKeys(), WithShortcutLeaves()}
+
+	tests := []struct {
+		name       string
+		start, end uint64
+		want       []uint64
+	}{
+		{"inner", 101, 200, []uint64{101, 102, 200}},
+		{"gap", 103, 199, nil},
+		{"single key", 102, 102, []uint64{102}},
+		{"everything", 0, ^uint64(0), []uint64{100, 101, 102, 200, 201, 0x1_0000}},
+		{"past the last key", 0x1_0001, ^uint64(0), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, leaves, err := tree.GenerateRangeProof(height(tt.start), height(tt.end))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(leaves) != len(tt.want) {
+				t.Fatalf("got %d leaves, want %d", len(leaves), len(tt.want))
+			}
+			for i, h := range tt.want {
+				if !bytes.Equal(leaves[i].KeyHash, height(h)) {
+					t.Errorf("leaf %d: got key %x, want %x", i, leaves[i].KeyHash, height(h))
+				}
+			}
+			if !VerifyRangeProof(root, height(tt.start), height(tt.end), leaves, proof, opts...) {
+				t.Fatal("range proof does not verify")
+			}
+			// 区间中的每个叶子都无法隐藏，也无法篡改
+			for i := range leaves {
+				hidden := append(append([]Leaf(nil), leaves[:i]...), leaves[i+1:]...)
+				if VerifyRangeProof(root, height(tt.start), height(tt.end), hidden, proof, opts...) {
+					t.Errorf("proof verifies with leaf %d hidden", i)
+				}
+				tampered := bytes.Clone(leaves[i].Value)
+				tampered[0] ^= 0x01
+				changed := append([]Leaf(nil), leaves...)
+				changed[i] = Leaf{KeyHash: leaves[i].KeyHash, Value: tampered}
+				if VerifyRangeProof(root, height(tt.start), height(tt.end), changed, proof, opts...) {
+					t.Errorf("proof verifies with leaf %d changed", i)
+				}
+			}
+			// 证明只对生成它的区间有效
+			if tt.start > 0 && VerifyRangeProof(root, height(tt.start-1), height(tt.end), leaves, proof, opts...) {
+				t.Error("proof verifies for a wider range")
+			}
+		})
+	}
+}
+
+func TestPrefixProof(t *testing.T) {
+	tree := newBlockTree(t, 100, 101, 102, 200, 201, 0x1_0000)
+	opts := []Option{WithRawKeys(), WithShortcutLeaves()}
+
+	tests := []struct {
+		name   string
+		prefix []byte
+		want   int
+		err    error
+	}{
+		{"below 65536", height(0)[:6], 5, nil},
+		{"high bytes", height(0x1_0000)[:6], 1, nil},
+		{"whole key", height(200), 1, nil},
+		{"empty prefix", nil, 6, nil},
+		{"too long", append(height(100), 0), 0, ErrInvalidRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, leaves, err := tree.GeneratePrefixProof(tt.prefix)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if len(leaves) != tt.want {
+				t.Errorf("got %d leaves, want %d", len(leaves), tt.want)
+			}
+			if !VerifyPrefixProof(tree.GetRoot(), tt.prefix, leaves, proof, opts...) {
+				t.Error("prefix proof does not verify")
+			}
+		})
+	}
+}
+
+func TestRangeProofInvalid(t *testing.T) {
+	tree := newBlockTree(t, 100)
+	tests := []struct {
+		name       string
+		start, end []byte
+	}{
+		{"reversed", height(200), height(100)},
+		{"short start", height(100)[:4], height(200)},
+		{"long end", height(100), append(height(200), 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := tree.GenerateRangeProof(tt.start, tt.end); !errors.Is(err, ErrInvalidRange) {
+				t.Errorf("got %v, want ErrInvalidRange", err)
+			}
+		})
+	}
+}
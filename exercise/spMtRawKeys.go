@@ -0,0 +1,62 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrInvalidKeyLength 原始键模式下键的长度与树的深度不一致
+var ErrInvalidKeyLength = errors.New("smt: key length does not match tree depth")
+
+// maxRawKeySize 原始键模式下键的最大长度（字节），限制验证者根据证明中的深度分配的内存
+const maxRawKeySize = 64
+
+// WithRawKeys 使用原始键模式：键本身（而不是它的哈希）就是从根到叶子的路径
+// 适用于账户编号、区块高度等定长的索引型状态：键按自然顺序排列，
+// 因此可以按顺序遍历（见 LeavesFrom）并证明一个区间内有哪些键（见 GenerateRangeProof）
+// 所有键的长度必须恰好为 depth/8 字节（depth 必须是 8 的倍数，最大为 512），否则返回 ErrInvalidKeyLength；
+// 多字节无符号整数应使用大端编码（例如 IntCodec[uint64]），使字节序与数值顺序一致；
+// IntCodec 把有符号数按补码存储，负数的字节序排在所有非负数之后，作为键时区间和遍历顺序与数值顺序不同
+// 注意:
+//   键不经过哈希，分布不再均匀：连续的键共享很长的公共前缀，默认模式下会物化更多的内部节点，
+//   通常应与 WithShortcutLeaves 一起使用；验证证明时同样需要传入 WithRawKeys
+func WithRawKeys() Option {
+	return func(c *treeConfig) {
+		c.raw = true
+	}
+}
+
+// hashKey 计算键在树中的路径（键哈希）
+// 原始键模式下就是键本身；复制一份，避免调用者之后修改传入的切片影响树中保存的键
+func (c *treeConfig) hashKey(key []byte) []byte {
+	if c.raw {
+		return bytes.Clone(key)
+	}
+	return c.hashData(key)
+}
+
+// checkKey 原始键模式下检查键的长度是否与深度为 depth 的树一致；其他模式下任意键都合法
+func (c *treeConfig) checkKey(key []byte, depth int) error {
+	if c.raw && len(key)*8 != depth {
+		return ErrInvalidKeyLength
+	}
+	return nil
+}
+
+// keySize 深度为 depth 的树中键哈希（路径）的字节长度
+func (c *treeConfig) keySize(depth int) int {
+	if c.raw {
+		return depth / 8
+	}
+	return c.hasher.Size()
+}
+
+// validDepth 检查证明中声明的深度是否合法
+// 哈希模式下路径由键哈希的比特位决定，深度不能超过哈希的比特数；
+// 原始键模式下深度由键的长度决定，必须是 8 的正整数倍，且不超过 maxRawKeySize 字节
+func (c *treeConfig) validDepth(depth int) bool {
+	if c.raw {
+		return depth > 0 && depth%8 == 0 && depth <= maxRawKeySize*8
+	}
+	return depth >= 0 && depth <= c.hasher.Size()*8
+}
@@ -0,0 +1,54 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRawKeyLength(t *testing.T) {
+	tree := NewSparseMerkleTree(64, WithRawKeys(), WithShortcutLeaves())
+	tests := []struct {
+		name string
+		key  []byte
+		err  error
+	}{
+		{"eight bytes", height(100), nil},
+		{"too short", []byte("100"), ErrInvalidKeyLength},
+		{"too long", append(height(100), 0), ErrInvalidKeyLength},
+		{"empty", nil, ErrInvalidKeyLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tree.Update(tt.key, []byte("block")); !errors.Is(err, tt.err) {
+				t.Errorf("Update: got %v, want %v", err, tt.err)
+			}
+			if _, _, err := tree.Get(tt.key); !errors.Is(err, tt.err) {
+				t.Errorf("Get: got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestRawKeyOrder 原始键模式下遍历顺序就是大端编码的数值顺序
+func TestRawKeyOrder(t *testing.T) {
+	heights := []uint64{0x1_0000, 7, 300, 0, 256, 1 << 63}
+	tree := newBlockTree(t, heights...)
+	want := []uint64{0, 7, 256, 300, 0x1_0000, 1 << 63}
+
+	var got [][]byte
+	for leaf, err := range tree.Leaves() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, leaf.KeyHash)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d leaves, want %d", len(got), len(want))
+	}
+	for i, h := range want {
+		if !bytes.Equal(got[i], height(h)) {
+			t.Errorf("leaf %d: got %x, want %x", i, got[i], height(h))
+		}
+	}
+}
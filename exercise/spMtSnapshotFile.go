@@ -0,0 +1,451 @@
+package exercise
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// ErrCorruptSnapshot 快照文件格式错误、被截断或校验和不符
+	ErrCorruptSnapshot = errors.New("smt: corrupt snapshot")
+	// ErrSnapshotRoot 按快照中的叶子重建出的根哈希与文件头中的根哈希不符
+	ErrSnapshotRoot = errors.New("smt: snapshot root does not match its leaves")
+	// ErrUnsupportedSnapshot 快照的格式版本或哈希算法不受支持
+	ErrUnsupportedSnapshot = errors.New("smt: unsupported snapshot")
+	// ErrSnapshotNoStore 导入快照时没有提供节点存储
+	ErrSnapshotNoStore = errors.New("smt: snapshot import requires a node store")
+)
+
+// 快照文件格式
+// 所有整数都是 uvarint，字节数组都以 uvarint 长度开头:
+//   文件头: "SMTS" | 格式版本(1 字节) | 模式标志(1 字节) | 深度 | 哈希算法名称 | 根哈希
+//   叶子:   0x01 | 键哈希 | 值     （按键哈希从小到大排列，每个叶子一条）
+//   结尾:   0x00 | 叶子数 | CRC-32（4 字节大端，覆盖之前的所有字节）
+const (
+	snapshotMagic   = "SMTS"
+	snapshotVersion = 1
+	snapshotChunk   = 1024    // 导入时每批写入的叶子数
+	snapshotValue   = 1 << 24 // 单个叶子值的最大字节数，伪造的长度不会让导入读取任意长的字段
+)
+
+// 快照记录的类型标记
+const (
+	snapshotTagEnd  byte = 0x00
+	snapshotTagLeaf byte = 0x01
+)
+
+// 模式标志，决定了树的结构和哈希，导入时以文件头为准
+const (
+	snapshotShortcut byte = 1 << 0 // WithShortcutLeaves
+	snapshotLegacy   byte = 1 << 1 // WithLegacyHashing
+	snapshotSum      byte = 1 << 2 // WithSums
+	snapshotRaw      byte = 1 << 3 // WithRawKeys
+)
+
+// WithStagingDir 指定 ReadSnapshot 存放暂存存储的目录
+// 暂存存储保存导入过程中的全部节点，大小与快照相当，默认放在 os.TempDir() 中；
+// 临时目录空间不足或位于内存文件系统时，可以改为调用者存储所在的磁盘
+// 参数:
+//   dir: 已存在的目录，导入结束后其中创建的临时文件会被删除
+func WithStagingDir(dir string) Option {
+	return func(c *treeConfig) {
+		c.stagingDir = dir
+	}
+}
+
+// WriteSnapshot 把树的当前状态以流式快照格式写入 w
+// 快照包含文件头（深度、哈希算法、模式和根哈希）、按顺序排列的所有叶子和校验和，
+// 可以在另一台机器上用 ReadSnapshot 确定性地重建出同一棵树
+// 参数:
+//   w: 输出，例如文件或网络连接
+// 返回:
+//   写入失败或加载节点失败时的错误
+// 注意:
+//   叶子通过迭代器逐个读取，使用节点存储时内存占用与树的大小无关；
+//   导出期间的写操作不会影响快照（见 View）
+func (smt *SparseMerkleTree) WriteSnapshot(w io.Writer) error {
+	return smt.View().WriteSnapshot(w)
+}
+
+// WriteSnapshot 把该版本的树以流式快照格式写入 w，见 SparseMerkleTree.WriteSnapshot
+func (s *Snapshot) WriteSnapshot(w io.Writer) error {
+	smt := s.tree
+	bw := bufio.NewWriter(w)
+	crc := crc32.NewIEEE()
+	out := io.MultiWriter(bw, crc)
+
+	var flags byte
+	if smt.shortcut {
+		flags |= snapshotShortcut
+	}
+	if smt.legacy {
+		flags |= snapshotLegacy
+	}
+	if smt.sum {
+		flags |= snapshotSum
+	}
+	if smt.raw {
+		flags |= snapshotRaw
+	}
+	header := append([]byte(snapshotMagic), snapshotVersion, flags)
+	header = binary.AppendUvarint(header, uint64(smt.depth))
+	header = appendSnapshotBytes(header, []byte(smt.hasher.Name()))
+	header = appendSnapshotBytes(header, s.GetRoot())
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	var count uint64
+	var record []byte
+	for leaf, err := range s.Leaves() {
+		if err != nil {
+			return err
+		}
+		record = append(record[:0], snapshotTagLeaf)
+		record = appendSnapshotBytes(record, leaf.KeyHash)
+		record = appendSnapshotBytes(record, leaf.Value)
+		if _, err := out.Write(record); err != nil {
+			return err
+		}
+		count++
+	}
+
+	trailer := binary.AppendUvarint([]byte{snapshotTagEnd}, count)
+	if _, err := out.Write(trailer); err != nil {
+		return err
+	}
+	if _, err := bw.Write(binary.BigEndian.AppendUint32(nil, crc.Sum32())); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ReadSnapshot 从流式快照重建一棵树
+// 参数:
+//   r: 由 WriteSnapshot 写出的快照
+//   opts: 新树的其他配置，必须包含 WithNodeStore；深度、存储模式和哈希布局以文件头为准。
+//         文件头中的哈希算法是内置算法时会自动使用，否则需要用 WithHasher 提供同名的算法；
+//         暂存存储的位置可以用 WithStagingDir 指定
+// 返回:
+//   重建的树（尚未提交任何版本），根哈希与文件头中的根哈希相同，节点保存在 WithNodeStore 指定的存储中
+//   err: 没有节点存储时返回 ErrSnapshotNoStore，旧布局的快照返回 ErrLegacyNodeStore，
+//        文件损坏时返回 ErrCorruptSnapshot，重建出的根与文件头不符时返回 ErrSnapshotRoot，
+//        格式版本或哈希算法不受支持时返回 ErrUnsupportedSnapshot
+// 工作原理:
+//   叶子按键哈希的顺序到达，每 snapshotChunk 个叶子作为一批写入；由于后一批总在前一批的右侧，
+//   每批只会修改树最右侧的一条路径。每批写入后都会把节点写入暂存存储并释放内存（暂存存储随后即被删除，不需要刷盘）；
+//   校验和与根哈希都验证通过后，才把根可达的节点复制到调用者的存储中
+// 注意:
+//   导入失败时调用者的存储不会被写入任何节点；
+//   节点本身不会留在内存中，但暂存存储的索引为每个节点保存一项，内存占用仍随快照中的叶子数线性增长
+func ReadSnapshot(r io.Reader, opts ...Option) (*SparseMerkleTree, error) {
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+	smt, root, err := sr.readHeader(opts)
+	if err != nil {
+		return nil, err
+	}
+	store := smt.store
+	if store == nil {
+		return nil, ErrSnapshotNoStore
+	}
+
+	dir, err := os.MkdirTemp(smt.stagingDir, "smt-snapshot")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	staging, err := OpenFileNodeStore(filepath.Join(dir, "nodes"))
+	if err != nil {
+		return nil, err
+	}
+	defer staging.Close()
+
+	smt.store = staging
+	if err := sr.readLeaves(smt); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(smt.GetRoot(), root) {
+		return nil, fmt.Errorf("%w: header %x, rebuilt %x", ErrSnapshotRoot, root, smt.GetRoot())
+	}
+	if err := smt.copyNodes(store, smt.root, 0); err != nil {
+		return nil, err
+	}
+	smt.store = store
+	return smt, nil
+}
+
+// snapshotReader 读取快照，同时计算已读取内容的校验和
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+// ReadByte 实现 io.ByteReader，用于读取 uvarint
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err != nil {
+		return 0, corruptSnapshot(err)
+	}
+	sr.crc.Write([]byte{b})
+	return b, nil
+}
+
+// readUvarint 读取一个 uvarint
+func (sr *snapshotReader) readUvarint() (uint64, error) {
+	n, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return 0, corruptSnapshot(err)
+	}
+	return n, nil
+}
+
+// readBytes 读取一个带长度的字节数组，长度超过 limit 时返回 ErrCorruptSnapshot
+// 按实际读到的数据增长缓冲区，伪造的长度不会导致大块的内存分配
+func (sr *snapshotReader) readBytes(limit uint64) ([]byte, error) {
+	n, err := sr.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > limit {
+		return nil, fmt.Errorf("%w: field of %d bytes", ErrCorruptSnapshot, n)
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(io.MultiWriter(&buf, sr.crc), sr.r, int64(n)); err != nil {
+		return nil, corruptSnapshot(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// readHeader 读取文件头，并按文件头创建一棵空树
+// 返回:
+//   空树和文件头中的根哈希
+func (sr *snapshotReader) readHeader(opts []Option) (*SparseMerkleTree, []byte, error) {
+	magic := make([]byte, len(snapshotMagic)+2)
+	for i := range magic {
+		b, err := sr.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		magic[i] = b
+	}
+	if string(magic[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, nil, fmt.Errorf("%w: bad magic", ErrCorruptSnapshot)
+	}
+	if magic[len(snapshotMagic)] != snapshotVersion {
+		return nil, nil, fmt.Errorf("%w: format version %d", ErrUnsupportedSnapshot, magic[len(snapshotMagic)])
+	}
+	flags := magic[len(snapshotMagic)+1]
+	if flags&^(snapshotShortcut|snapshotLegacy|snapshotSum|snapshotRaw) != 0 {
+		return nil, nil, fmt.Errorf("%w: unknown flags %#x", ErrUnsupportedSnapshot, flags)
+	}
+	depth, err := sr.readUvarint()
+	if err != nil {
+		return nil, nil, err
+	}
+	name, err := sr.readBytes(64)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 按文件头确定配置：调用者的选项在前，文件头中的模式在后，以文件头为准
+	opts = append(opts[:len(opts):len(opts)], func(c *treeConfig) {
+		c.shortcut = flags&snapshotShortcut != 0
+		c.legacy = flags&snapshotLegacy != 0
+		c.sum = flags&snapshotSum != 0
+		c.raw = flags&snapshotRaw != 0
+		c.openRoot = nil
+	})
+	c := newTreeConfig(opts)
+	if c.hasher.Name() != string(name) {
+		hasher, ok := builtinHasher(string(name))
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: hasher %q", ErrUnsupportedSnapshot, name)
+		}
+		opts = append(opts, WithHasher(hasher))
+		c.hasher = hasher
+	}
+	if depth == 0 || depth > maxRawKeySize*8 || !c.validDepth(int(depth)) {
+		return nil, nil, fmt.Errorf("%w: depth %d", ErrCorruptSnapshot, depth)
+	}
+	if err := c.checkStore(); err != nil {
+		return nil, nil, err
+	}
+
+	root, err := sr.readBytes(uint64(c.digestSize()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewSparseMerkleTree(int(depth), opts...), root, nil
+}
+
+// readLeaves 读取所有叶子并分批写入 smt，最后检查结尾的叶子数和校验和
+func (sr *snapshotReader) readLeaves(smt *SparseMerkleTree) error {
+	size := smt.keySize(smt.depth)
+	var prev []byte
+	var count uint64
+	batch := make([]batchItem, 0, snapshotChunk)
+	for {
+		tag, err := sr.ReadByte()
+		if err != nil {
+			return err
+		}
+		if tag == snapshotTagEnd {
+			break
+		}
+		if tag != snapshotTagLeaf {
+			return fmt.Errorf("%w: unknown record %#x", ErrCorruptSnapshot, tag)
+		}
+		keyHash, err := sr.readBytes(uint64(size))
+		if err != nil {
+			return err
+		}
+		value, err := sr.readBytes(snapshotValue)
+		if err != nil {
+			return err
+		}
+		if len(keyHash) != size {
+			return fmt.Errorf("%w: key of %d bytes", ErrCorruptSnapshot, len(keyHash))
+		}
+		// 叶子必须严格递增；相邻的键共享全部 depth 位说明它们在树中冲突
+		if prev != nil {
+			if bytes.Compare(prev, keyHash) >= 0 {
+				return fmt.Errorf("%w: leaves out of order", ErrCorruptSnapshot)
+			}
+			if commonPrefix(prev, keyHash, smt.depth) == smt.depth {
+				return ErrKeyCollision
+			}
+		}
+		if err := smt.checkAmount(value); err != nil {
+			return err
+		}
+		prev = keyHash
+		count++
+		batch = append(batch, batchItem{
+			keyHash:  keyHash,
+			value:    value,
+			leafHash: smt.hashLeaf(keyHash, smt.hashValue(value)),
+		})
+		if len(batch) == snapshotChunk {
+			if err := smt.importBatch(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := smt.importBatch(batch); err != nil {
+		return err
+	}
+
+	n, err := sr.readUvarint()
+	if err != nil {
+		return err
+	}
+	if n != count {
+		return fmt.Errorf("%w: trailer counts %d leaves, read %d", ErrCorruptSnapshot, n, count)
+	}
+	want := sr.crc.Sum32()
+	var sum [4]byte
+	if _, err := io.ReadFull(sr.r, sum[:]); err != nil {
+		return corruptSnapshot(err)
+	}
+	if binary.BigEndian.Uint32(sum[:]) != want {
+		return fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+	}
+	return nil
+}
+
+// importBatch 写入一批已排序、互不冲突的叶子，随后写入暂存存储并释放内存
+// 与 flush 不同，这里不刷盘：暂存存储在导入结束后就会被删除
+// 树只属于导入它的 goroutine，不需要加锁
+func (smt *SparseMerkleTree) importBatch(batch []batchItem) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	sem := make(chan struct{}, smt.workers-1)
+	root, err := smt.updateBatch(smt.root, batch, 0, sem)
+	if err != nil {
+		return err
+	}
+	if err := smt.checkSum(root); err != nil {
+		return err
+	}
+	if err := smt.persist(root); err != nil {
+		return err
+	}
+	smt.root = stubNode(root.hash)
+	return nil
+}
+
+// copyNodes 把 node 子树的节点从树当前的存储复制到 dst
+// 先复制子节点再复制父节点，dst 中已有的节点（及其整棵子树）直接跳过；
+// 每个节点的编码只从暂存存储读取一次，检查 dst 中是否已有该节点时不读取它的编码（见 hasNode）
+func (smt *SparseMerkleTree) copyNodes(dst NodeStore, node *Node, depth int) error {
+	if node == nil {
+		return nil
+	}
+	if ok, err := hasNode(dst, node.hash); err != nil || ok {
+		return err
+	}
+	data, err := smt.store.Get(node.hash)
+	if err != nil {
+		return err
+	}
+	loaded, err := smt.decodeNode(node.hash, data, depth)
+	if err != nil {
+		return err
+	}
+	if err := smt.copyNodes(dst, loaded.left, depth+1); err != nil {
+		return err
+	}
+	if err := smt.copyNodes(dst, loaded.right, depth+1); err != nil {
+		return err
+	}
+	return dst.Put(node.hash, data)
+}
+
+// hasNode 检查存储中是否已有该节点
+// 存储实现了 Has 方法时直接查询索引（MemoryNodeStore、FileNodeStore），否则退回到 Get
+func hasNode(store NodeStore, hash []byte) (bool, error) {
+	if s, ok := store.(interface{ Has(hash []byte) bool }); ok {
+		return s.Has(hash), nil
+	}
+	if _, err := store.Get(hash); err != nil {
+		if errors.Is(err, ErrNodeNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// appendSnapshotBytes 追加带 uvarint 长度的字节数组
+func appendSnapshotBytes(buf, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// corruptSnapshot 把读取时遇到的文件结尾转换为 ErrCorruptSnapshot，其他错误原样返回
+func corruptSnapshot(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: truncated", ErrCorruptSnapshot)
+	}
+	return err
+}
+
+// builtinHasher 按名称查找内置的哈希算法
+func builtinHasher(name string) (Hasher, bool) {
+	for _, h := range []Hasher{SHA256Hasher, SHA512_256Hasher, SHA3_256Hasher} {
+		if h.Name() == name {
+			return h, true
+		}
+	}
+	return nil, false
+}
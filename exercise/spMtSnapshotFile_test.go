@@ -0,0 +1,212 @@
+package exercise
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// countingStore 记录写入次数的节点存储
+type countingStore struct {
+	NodeStore
+	puts int
+}
+
+func (s *countingStore) Put(hash, data []byte) error {
+	s.puts++
+	return s.NodeStore.Put(hash, data)
+}
+
+// newSnapshotTree 返回包含 n 个叶子的树及其快照
+func newSnapshotTree(t *testing.T, n int) (*SparseMerkleTree, []byte) {
+	t.Helper()
+	tree := NewSparseMerkleTree(256, WithShortcutLeaves())
+	pairs := make([]KeyValue, n)
+	for i := range pairs {
+		pairs[i] = KeyValue{Key: []byte(fmt.Sprintf("account%d", i)), Value: []byte(fmt.Sprint(i))}
+	}
+	if err := tree.UpdateBatch(pairs); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tree.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return tree, buf.Bytes()
+}
+
+// resum 重新计算快照结尾的校验和，使修改过的快照能够通过校验
+func resum(b []byte) []byte {
+	binary.BigEndian.PutUint32(b[len(b)-4:], crc32.ChecksumIEEE(b[:len(b)-4]))
+	return b
+}
+
+func TestReadSnapshot(t *testing.T) {
+	// 多于 snapshotChunk 个叶子，导入时分多批写入
+	tree, data := newSnapshotTree(t, 2*snapshotChunk+7)
+
+	if _, err := ReadSnapshot(bytes.NewReader(data)); !errors.Is(err, ErrSnapshotNoStore) {
+		t.Errorf("without a node store: got %v, want ErrSnapshotNoStore", err)
+	}
+
+	store := NewMemoryNodeStore()
+	imported, err := ReadSnapshot(bytes.NewReader(data), WithNodeStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(imported.GetRoot(), tree.GetRoot()) {
+		t.Fatalf("root: got %x, want %x", imported.GetRoot(), tree.GetRoot())
+	}
+	// 节点必须都在调用者的存储中：只凭根哈希重新打开
+	reopened := NewSparseMerkleTree(256, WithShortcutLeaves(), WithNodeStore(store), WithRoot(tree.GetRoot()))
+	for _, i := range []int{0, snapshotChunk, 2 * snapshotChunk} {
+		key := []byte(fmt.Sprintf("account%d", i))
+		value, found, err := reopened.Get(key)
+		if err != nil || !found || string(value) != fmt.Sprint(i) {
+			t.Errorf("%s: got %q (found=%v, err=%v)", key, value, found, err)
+		}
+	}
+}
+
+// TestReadSnapshotRejected 导入失败时不能向调用者的存储写入任何节点
+func TestReadSnapshotRejected(t *testing.T) {
+	tree, data := newSnapshotTree(t, 2*snapshotChunk+7)
+	rootAt := bytes.Index(data, tree.GetRoot())
+	// 第一个叶子的值长度紧跟在它的键哈希之后
+	var first []byte
+	for leaf, err := range tree.Leaves() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		first = leaf.KeyHash
+		break
+	}
+	valueAt := bytes.Index(data, first) + len(first)
+	tests := []struct {
+		name   string
+		mutate func([]byte) []byte
+		want   error
+	}{
+		{"header root", func(b []byte) []byte { b[rootAt] ^= 0x01; return resum(b) }, ErrSnapshotRoot},
+		{"leaf value", func(b []byte) []byte { b[len(b)/2] ^= 0x01; return b }, ErrCorruptSnapshot},
+		{"checksum", func(b []byte) []byte { b[len(b)-1] ^= 0x01; return b }, ErrCorruptSnapshot},
+		{"truncated", func(b []byte) []byte { return b[:len(b)-5] }, ErrCorruptSnapshot},
+		{"value length", func(b []byte) []byte {
+			// 值的长度超过 snapshotValue 时不读取值本身
+			return append(binary.AppendUvarint(b[:valueAt:valueAt], snapshotValue+1), b[valueAt+1:]...)
+		}, ErrCorruptSnapshot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &countingStore{NodeStore: NewMemoryNodeStore()}
+			_, err := ReadSnapshot(bytes.NewReader(tt.mutate(bytes.Clone(data))), WithNodeStore(store))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			if store.puts != 0 {
+				t.Errorf("failed import wrote %d nodes to the store", store.puts)
+			}
+		})
+	}
+}
+
+// TestSnapshotModes 快照保留树的模式：导入时以文件头为准，不需要调用者再次指定
+func TestSnapshotModes(t *testing.T) {
+	tests := []struct {
+		name  string
+		depth int
+		opts  []Option
+		key   func(i int) []byte
+		value func(i int) []byte
+	}{
+		{
+			name:  "hashed keys",
+			depth: 256,
+			key:   func(i int) []byte { return []byte(fmt.Sprintf("account%d", i)) },
+			value: func(i int) []byte { return []byte(fmt.Sprint(i)) },
+		},
+		{
+			name:  "sums",
+			depth: 256,
+			opts:  []Option{WithSums(), WithShortcutLeaves()},
+			key:   func(i int) []byte { return []byte(fmt.Sprintf("account%d", i)) },
+			value: func(i int) []byte { return SumValue(uint64(i), []byte("data")) },
+		},
+		{
+			name:  "raw keys",
+			depth: 64,
+			opts:  []Option{WithRawKeys(), WithShortcutLeaves()},
+			key:   func(i int) []byte { return binary.BigEndian.AppendUint64(nil, uint64(i*7919)) },
+			value: func(i int) []byte { return []byte(fmt.Sprintf("block-%d", i)) },
+		},
+		{
+			name:  "sha3",
+			depth: 256,
+			opts:  []Option{WithHasher(SHA3_256Hasher)},
+			key:   func(i int) []byte { return []byte(fmt.Sprintf("account%d", i)) },
+			value: func(i int) []byte { return []byte(fmt.Sprint(i)) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewSparseMerkleTree(tt.depth, tt.opts...)
+			for i := 0; i < 100; i++ {
+				if err := tree.Update(tt.key(i), tt.value(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var buf bytes.Buffer
+			if err := tree.WriteSnapshot(&buf); err != nil {
+				t.Fatal(err)
+			}
+			imported, err := ReadSnapshot(&buf, WithNodeStore(NewMemoryNodeStore()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(imported.GetRoot(), tree.GetRoot()) {
+				t.Fatalf("root: got %x, want %x", imported.GetRoot(), tree.GetRoot())
+			}
+			if imported.depth != tree.depth || imported.shortcut != tree.shortcut || imported.sum != tree.sum ||
+				imported.raw != tree.raw || imported.hasher.Name() != tree.hasher.Name() {
+				t.Errorf("imported config does not match the tree")
+			}
+			value, found, err := imported.Get(tt.key(42))
+			if err != nil || !found || !bytes.Equal(value, tt.value(42)) {
+				t.Errorf("key 42: got %q (found=%v, err=%v)", value, found, err)
+			}
+			if tree.sum {
+				want, _ := tree.Sum()
+				if got, err := imported.Sum(); err != nil || got != want {
+					t.Errorf("sum: got %d (%v), want %d", got, err, want)
+				}
+			}
+		})
+	}
+}
+
+// TestReadSnapshotStagingDir 暂存存储放在 WithStagingDir 指定的目录中，导入结束后被删除
+func TestReadSnapshotStagingDir(t *testing.T) {
+	tree, data := newSnapshotTree(t, snapshotChunk+1)
+	dir := t.TempDir()
+	imported, err := ReadSnapshot(bytes.NewReader(data), WithNodeStore(NewMemoryNodeStore()), WithStagingDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(imported.GetRoot(), tree.GetRoot()) {
+		t.Errorf("root: got %x, want %x", imported.GetRoot(), tree.GetRoot())
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Errorf("staging dir after import: %d entries (%v)", len(entries), err)
+	}
+
+	missing := filepath.Join(dir, "missing")
+	if _, err := ReadSnapshot(bytes.NewReader(data), WithNodeStore(NewMemoryNodeStore()), WithStagingDir(missing)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing staging dir: got %v, want fs.ErrNotExist", err)
+	}
+}
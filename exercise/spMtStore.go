@@ -0,0 +1,527 @@
+package exercise
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	// ErrNodeNotFound 存储中没有该哈希对应的节点
+	ErrNodeNotFound = errors.New("smt: node not found in store")
+	// ErrCorruptNode 存储中的节点编码无法解析，或者内容的哈希与请求的哈希不符
+	ErrCorruptNode = errors.New("smt: corrupt node encoding")
+	// ErrLegacyNodeStore 旧哈希布局不能与节点存储一起使用
+	// 旧布局的叶子哈希不绑定键，值相同的两个叶子哈希相同，无法按哈希区分
+	ErrLegacyNodeStore = errors.New("smt: node store requires domain-separated hashing")
+	// ErrStoreFailed 文件节点存储在替换文件的中途失败，内存中的状态与磁盘上的文件不再一致
+	// 之后的所有读写都返回该错误，需要关闭后重新打开存储
+	ErrStoreFailed = errors.New("smt: node store failed")
+)
+
+// NodeStore 节点存储
+// 节点以自身的哈希为键保存，因此相同的子树只保存一次，不同版本可以共享节点
+// 同一个存储只应被相同配置（深度、哈希算法、存储模式）的树使用
+// 实现必须可以被多个 goroutine 同时调用
+type NodeStore interface {
+	Get(hash []byte) ([]byte, error) // 读取节点编码，不存在时返回 ErrNodeNotFound
+	Put(hash, data []byte) error     // 写入节点编码，哈希已存在时可以直接忽略
+}
+
+// WithNodeStore 指定树使用的节点存储
+// 修改只在内存中进行，Commit 时才把新节点写入存储，之后这些节点会从内存中释放，
+// 再次访问时按需从存储中加载，因此树的大小不再受内存限制
+// 参数:
+//   store: 节点存储，例如 NewMemoryNodeStore() 或 OpenFileNodeStore(path)
+func WithNodeStore(store NodeStore) Option {
+	return func(c *treeConfig) {
+		c.store = store
+	}
+}
+
+// WithRoot 打开存储中已有的根
+// 节点不会立即加载，而是在遍历时按需读取；根哈希等于空树的根哈希时得到一棵空树
+// 参数:
+//   root: 之前 Commit 后 GetRoot 返回的根哈希，需要同时使用 WithNodeStore
+func WithRoot(root []byte) Option {
+	return func(c *treeConfig) {
+		c.openRoot = root
+	}
+}
+
+// 节点编码的类型标记
+const (
+	nodeTagLeaf     byte = 0x00 // 叶子: tag | uvarint(len(key)) | key | value
+	nodeTagInternal byte = 0x01 // 内部节点: tag | 子节点掩码 | 左子哈希(可选) | 右子哈希(可选)
+)
+
+// 内部节点编码中的子节点掩码，未设置的一侧是空子树
+const (
+	childLeft  byte = 1 << 0
+	childRight byte = 1 << 1
+)
+
+// checkStore 检查节点存储与哈希布局是否兼容
+// 返回:
+//   同时使用旧布局和节点存储时返回 ErrLegacyNodeStore
+func (c *treeConfig) checkStore() error {
+	if c.legacy && c.store != nil {
+		return ErrLegacyNodeStore
+	}
+	return nil
+}
+
+// stubNode 返回只有哈希、尚未加载的节点，访问时由 load 从存储中读取
+func stubNode(hash []byte) *Node {
+	return &Node{hash: hash, lazy: true, stored: true}
+}
+
+// load 确保节点已经加载
+// 参数:
+//   node: 要访问的节点，可以是 nil（空子树）
+//   depth: 节点所在的层，用于校验从存储读到的编码（见 decodeNode）
+// 返回:
+//   已加载的节点；node 不是延迟加载的节点时原样返回
+// 注意:
+//   加载得到的是一个新节点，原来的占位节点保持不变，因此多个读者可以同时加载同一个节点
+func (smt *SparseMerkleTree) load(node *Node, depth int) (*Node, error) {
+	if node == nil || !node.lazy {
+		return node, nil
+	}
+	if smt.store == nil {
+		return nil, fmt.Errorf("%w: %x (no node store configured)", ErrNodeNotFound, node.hash)
+	}
+	data, err := smt.store.Get(node.hash)
+	if err != nil {
+		return nil, err
+	}
+	return smt.decodeNode(node.hash, data, depth)
+}
+
+// persist 把 node 子树中尚未保存的节点写入存储
+// 先写子节点再写父节点，已保存的节点（及其整棵子树）直接跳过
+func (smt *SparseMerkleTree) persist(node *Node) error {
+	if node == nil || node.stored {
+		return nil
+	}
+	if err := smt.persist(node.left); err != nil {
+		return err
+	}
+	if err := smt.persist(node.right); err != nil {
+		return err
+	}
+	if err := smt.journal.inject(faultStorePut); err != nil {
+		return err
+	}
+	return smt.store.Put(node.hash, smt.encodeNode(node))
+}
+
+// encodeNode 编码节点，子节点只记录哈希
+func (smt *SparseMerkleTree) encodeNode(node *Node) []byte {
+	if node.key != nil {
+		buf := make([]byte, 0, 1+binary.MaxVarintLen64+len(node.key)+len(node.value))
+		buf = append(buf, nodeTagLeaf)
+		buf = binary.AppendUvarint(buf, uint64(len(node.key)))
+		buf = append(buf, node.key...)
+		return append(buf, node.value...)
+	}
+	buf := make([]byte, 2, 2+2*smt.digestSize())
+	buf[0] = nodeTagInternal
+	if node.left != nil {
+		buf[1] |= childLeft
+		buf = append(buf, node.left.hash...)
+	}
+	if node.right != nil {
+		buf[1] |= childRight
+		buf = append(buf, node.right.hash...)
+	}
+	return buf
+}
+
+// decodeNode 解码第 depth 层的节点，子节点为尚未加载的占位节点
+// 解码后按节点的内容重新计算哈希，与请求的哈希不同时返回 ErrCorruptNode，
+// 因此存储返回的错误数据（损坏、或者属于另一个哈希）不会被当作该节点使用
+func (smt *SparseMerkleTree) decodeNode(hash, data []byte, depth int) (*Node, error) {
+	node, err := smt.parseNode(hash, data)
+	if err != nil {
+		return nil, err
+	}
+	if node.key == nil && depth >= smt.depth {
+		return nil, fmt.Errorf("%w: %x (internal node at the leaf level)", ErrCorruptNode, hash)
+	}
+	var want []byte
+	if node.key != nil {
+		want = smt.foldLeaf(node.key, smt.hashLeaf(node.key, smt.hashValue(node.value)), depth, smt.depth, smt.defaults)
+	} else {
+		want = smt.hashNodes(smt.hashOf(node.left, depth+1), smt.hashOf(node.right, depth+1))
+	}
+	if !bytes.Equal(want, hash) {
+		return nil, fmt.Errorf("%w: %x (content hashes to %x)", ErrCorruptNode, hash, want)
+	}
+	return node, nil
+}
+
+// parseNode 解析节点编码，不校验哈希
+func (smt *SparseMerkleTree) parseNode(hash, data []byte) (*Node, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: %x", ErrCorruptNode, hash)
+	}
+	size := smt.digestSize()
+	switch data[0] {
+	case nodeTagLeaf:
+		keyLen, n := binary.Uvarint(data[1:])
+		if n <= 0 || keyLen != uint64(smt.keySize(smt.depth)) || uint64(len(data)-1-n) < keyLen {
+			return nil, fmt.Errorf("%w: %x", ErrCorruptNode, hash)
+		}
+		rest := data[1+n:]
+		return &Node{
+			hash:   hash,
+			key:    rest[:keyLen:keyLen],
+			value:  rest[keyLen:],
+			stored: true,
+		}, nil
+	case nodeTagInternal:
+		if len(data) < 2 {
+			return nil, fmt.Errorf("%w: %x", ErrCorruptNode, hash)
+		}
+		mask, rest := data[1], data[2:]
+		node := &Node{hash: hash, stored: true}
+		if mask&childLeft != 0 && len(rest) >= size {
+			node.left, rest = stubNode(rest[:size:size]), rest[size:]
+		}
+		if mask&childRight != 0 && len(rest) >= size {
+			node.right, rest = stubNode(rest[:size:size]), rest[size:]
+		}
+		if mask&^(childLeft|childRight) != 0 || mask == 0 || len(rest) != 0 ||
+			(mask&childLeft != 0) != (node.left != nil) || (mask&childRight != 0) != (node.right != nil) {
+			return nil, fmt.Errorf("%w: %x", ErrCorruptNode, hash)
+		}
+		return node, nil
+	default:
+		return nil, fmt.Errorf("%w: %x", ErrCorruptNode, hash)
+	}
+}
+
+// MemoryNodeStore 内存中的节点存储
+// 适合测试，或在同一进程中让多棵树共享节点
+type MemoryNodeStore struct {
+	mu    sync.RWMutex
+	nodes map[string][]byte // 节点哈希 -> 节点编码
+}
+
+// NewMemoryNodeStore 创建空的内存节点存储
+func NewMemoryNodeStore() *MemoryNodeStore {
+	return &MemoryNodeStore{nodes: make(map[string][]byte)}
+}
+
+// Get 读取节点编码
+func (s *MemoryNodeStore) Get(hash []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.nodes[string(hash)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %x", ErrNodeNotFound, hash)
+	}
+	return data, nil
+}
+
+// Has 报告存储中是否有该节点
+func (s *MemoryNodeStore) Has(hash []byte) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.nodes[string(hash)]
+	return ok
+}
+
+// Put 写入节点编码（复制一份，调用者之后可以修改 data）
+func (s *MemoryNodeStore) Put(hash, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.nodes[string(hash)]; !ok {
+		s.nodes[string(hash)] = append([]byte(nil), data...)
+	}
+	return nil
+}
+
+// FileNodeStore 只追加的文件节点存储
+// 文件由一条条记录组成，每条记录:
+//   hashLen(1 字节) | dataLen(4 字节，大端) | hash | data | CRC32(前面所有字段)
+// 已有的记录从不修改，打开时扫描整个文件在内存中建立 哈希 -> 位置 的索引
+// 进程在写入中途崩溃时，文件末尾可能留下不完整的记录，打开时校验失败的尾部会被截断
+// 回收节点（见 Sweep）时把仍然需要的记录写入新文件，再原子地替换旧文件
+type FileNodeStore struct {
+	mu     sync.RWMutex
+	path   string
+	file   *os.File
+	size   int64                    // 有效数据的长度，即下一条记录的写入位置
+	index  map[string]fileRecord    // 节点哈希 -> 节点编码在文件中的位置
+	failed error                    // 非 nil 时存储已失败（见 ErrStoreFailed），所有操作都返回它
+	fault  func(point string) error // 故障注入钩子，返回错误时模拟该步骤失败
+}
+
+// fileRecord 节点编码在文件中的位置
+type fileRecord struct {
+	offset int64 // 节点编码的起始位置
+	length int   // 节点编码的长度
+}
+
+// fileRecordHeader 每条记录的头部长度（hashLen + dataLen）
+const fileRecordHeader = 1 + 4
+
+// OpenFileNodeStore 打开或创建文件节点存储
+// 参数:
+//   path: 文件路径，不存在时自动创建
+// 返回:
+//   打开的存储；用完后需要调用 Close
+func OpenFileNodeStore(path string) (*FileNodeStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileNodeStore{path: path, file: file, index: make(map[string]fileRecord)}
+	if err := s.scan(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// scan 读取所有完整的记录建立索引，并截断末尾不完整的记录
+func (s *FileNodeStore) scan() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(s.file)
+	header := make([]byte, fileRecordHeader)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			break // 正常结束或尾部头部不完整
+		}
+		hashLen, dataLen := int(header[0]), int(binary.BigEndian.Uint32(header[1:]))
+		if s.size+int64(fileRecordHeader+hashLen+dataLen+4) > info.Size() {
+			break // 长度字段本身可能已损坏，不按它分配内存
+		}
+		body := make([]byte, hashLen+dataLen+4)
+		if _, err := io.ReadFull(r, body); err != nil {
+			break
+		}
+		crc := crc32.NewIEEE()
+		crc.Write(header)
+		crc.Write(body[:hashLen+dataLen])
+		if crc.Sum32() != binary.BigEndian.Uint32(body[hashLen+dataLen:]) {
+			break
+		}
+		s.index[string(body[:hashLen])] = fileRecord{
+			offset: s.size + fileRecordHeader + int64(hashLen),
+			length: dataLen,
+		}
+		s.size += int64(fileRecordHeader + len(body))
+	}
+	return s.file.Truncate(s.size)
+}
+
+// Get 读取节点编码
+func (s *FileNodeStore) Get(hash []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock() // Sweep 会替换文件，读取期间需要持有锁
+	if s.failed != nil {
+		return nil, s.failed
+	}
+	rec, ok := s.index[string(hash)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %x", ErrNodeNotFound, hash)
+	}
+	data := make([]byte, rec.length)
+	if _, err := s.file.ReadAt(data, rec.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Has 报告存储中是否有该节点，只查询内存中的索引，不读取文件；存储已失败时返回 false
+func (s *FileNodeStore) Has(hash []byte) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.index[string(hash)]
+	return ok && s.failed == nil
+}
+
+// Put 在文件末尾追加一条记录；哈希已存在时不重复写入
+// 写入失败时不会更新索引，下一次写入会覆盖这条不完整的记录
+func (s *FileNodeStore) Put(hash, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed != nil {
+		return s.failed
+	}
+	if _, ok := s.index[string(hash)]; ok {
+		return nil
+	}
+	rec := encodeFileRecord(hash, data)
+	if _, err := s.file.WriteAt(rec, s.size); err != nil {
+		return err
+	}
+	s.index[string(hash)] = fileRecord{
+		offset: s.size + fileRecordHeader + int64(len(hash)),
+		length: len(data),
+	}
+	s.size += int64(len(rec))
+	return nil
+}
+
+// encodeFileRecord 编码一条节点记录（带 CRC32 校验和）
+func encodeFileRecord(hash, data []byte) []byte {
+	rec := make([]byte, fileRecordHeader, fileRecordHeader+len(hash)+len(data)+4)
+	rec[0] = byte(len(hash))
+	binary.BigEndian.PutUint32(rec[1:], uint32(len(data)))
+	rec = append(rec, hash...)
+	rec = append(rec, data...)
+	return binary.BigEndian.AppendUint32(rec, crc32.ChecksumIEEE(rec))
+}
+
+// Sync 把已写入的记录刷到磁盘，Commit 在写完所有节点后会调用它
+func (s *FileNodeStore) Sync() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.failed != nil {
+		return s.failed
+	}
+	return s.file.Sync()
+}
+
+// Close 关闭文件
+func (s *FileNodeStore) Close() error {
+	return s.file.Close()
+}
+
+// Sweep 删除 live 返回 false 的所有节点，见 PrunableNodeStore
+func (s *MemoryNodeStore) Sweep(live func(hash []byte) bool) (int, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var nodes int
+	var freed int64
+	for hash, data := range s.nodes {
+		if !live([]byte(hash)) {
+			delete(s.nodes, hash)
+			nodes++
+			freed += int64(len(hash) + len(data))
+		}
+	}
+	return nodes, freed, nil
+}
+
+// Sweep 删除 live 返回 false 的所有节点，见 PrunableNodeStore
+// 仍然需要的记录被写入临时文件，刷盘后通过 rename 原子地替换旧文件，
+// 因此无论在哪一步崩溃，打开时看到的都是完整的旧文件或完整的新文件
+// 替换期间持有写锁，并发的 Get 会等待替换完成
+// rename 成功后磁盘上已经是新文件，之后的步骤失败时仍然切换到新文件；
+// 连新文件都无法打开时，存储进入失败状态（见 ErrStoreFailed）
+func (s *FileNodeStore) Sweep(live func(hash []byte) bool) (int, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed != nil {
+		return 0, 0, s.failed
+	}
+
+	var nodes int
+	var freed int64
+	for hash, rec := range s.index {
+		if !live([]byte(hash)) {
+			nodes++
+			freed += int64(len(hash) + rec.length)
+		}
+	}
+	if nodes == 0 {
+		return 0, 0, nil
+	}
+
+	tmpPath := s.path + ".tmp"
+	index, size, err := s.rewrite(tmpPath, live)
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, 0, err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return 0, 0, err
+	}
+
+	// 旧的文件句柄指向已被替换的文件，继续写入的记录会在下次打开时丢失，因此必须切换到新文件
+	syncErr := s.inject(faultSweepSyncDir)
+	if syncErr == nil {
+		syncErr = syncDir(filepath.Dir(s.path))
+	}
+	file, err := s.reopen()
+	if err != nil {
+		s.failed = fmt.Errorf("%w: reopen %s after sweep: %v", ErrStoreFailed, s.path, err)
+		return 0, 0, s.failed
+	}
+	s.file.Close()
+	s.file, s.index, s.size = file, index, size
+	if syncErr != nil {
+		return 0, 0, syncErr
+	}
+	return nodes, freed, nil
+}
+
+// reopen 打开替换后的新文件
+func (s *FileNodeStore) reopen() (*os.File, error) {
+	if err := s.inject(faultSweepReopen); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(s.path, os.O_RDWR, 0o644)
+}
+
+// inject 调用故障注入钩子；没有设置钩子时总是成功
+func (s *FileNodeStore) inject(point string) error {
+	if s.fault == nil {
+		return nil
+	}
+	return s.fault(point)
+}
+
+// rewrite 把仍然需要的记录写入 path 并刷盘，返回新文件的索引和长度
+func (s *FileNodeStore) rewrite(path string, live func(hash []byte) bool) (map[string]fileRecord, int64, error) {
+	tmp, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	index := make(map[string]fileRecord, len(s.index))
+	var size int64
+	for hash, rec := range s.index {
+		if !live([]byte(hash)) {
+			continue
+		}
+		data := make([]byte, rec.length)
+		if _, err := s.file.ReadAt(data, rec.offset); err != nil {
+			return nil, 0, err
+		}
+		record := encodeFileRecord([]byte(hash), data)
+		if _, err := w.Write(record); err != nil {
+			return nil, 0, err
+		}
+		index[hash] = fileRecord{
+			offset: size + fileRecordHeader + int64(len(hash)),
+			length: rec.length,
+		}
+		size += int64(len(record))
+	}
+	if err := w.Flush(); err != nil {
+		return nil, 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return nil, 0, err
+	}
+	return index, size, nil
+}
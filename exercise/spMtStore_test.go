@@ -0,0 +1,348 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// openFileStore 在测试的临时目录中打开文件节点存储
+func openFileStore(t *testing.T, path string) *FileNodeStore {
+	t.Helper()
+	store, err := OpenFileNodeStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestNodeStores(t *testing.T) {
+	stores := []struct {
+		name  string
+		store func(t *testing.T) PrunableNodeStore
+	}{
+		{"memory", func(*testing.T) PrunableNodeStore { return NewMemoryNodeStore() }},
+		{"file", func(t *testing.T) PrunableNodeStore {
+			return openFileStore(t, filepath.Join(t.TempDir(), "nodes.db"))
+		}},
+	}
+	for _, s := range stores {
+		t.Run(s.name, func(t *testing.T) {
+			store := s.store(t)
+			data := []byte("data")
+			if err := store.Put([]byte("a"), data); err != nil {
+				t.Fatal(err)
+			}
+			data[0] = 'X' // 存储保存的是副本
+			if err := store.Put([]byte("a"), []byte("other")); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := store.Get([]byte("a")); err != nil || string(got) != "data" {
+				t.Errorf("Get: got %q (%v), want the first value", got, err)
+			}
+			if _, err := store.Get([]byte("b")); !errors.Is(err, ErrNodeNotFound) {
+				t.Errorf("missing node: got %v, want ErrNodeNotFound", err)
+			}
+			if has, ok := store.(interface{ Has(hash []byte) bool }); !ok || !has.Has([]byte("a")) || has.Has([]byte("b")) {
+				t.Error("Has does not match Get")
+			}
+
+			if err := store.Put([]byte("b"), []byte("dead")); err != nil {
+				t.Fatal(err)
+			}
+			nodes, freed, err := store.Sweep(func(hash []byte) bool { return string(hash) == "a" })
+			if err != nil || nodes != 1 || freed != int64(len("b")+len("dead")) {
+				t.Errorf("Sweep: got %d nodes, %d bytes (%v)", nodes, freed, err)
+			}
+			if _, err := store.Get([]byte("b")); !errors.Is(err, ErrNodeNotFound) {
+				t.Errorf("swept node: got %v, want ErrNodeNotFound", err)
+			}
+			if got, err := store.Get([]byte("a")); err != nil || string(got) != "data" {
+				t.Errorf("live node after Sweep: got %q (%v)", got, err)
+			}
+			if err := store.Put([]byte("c"), []byte("new")); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := store.Get([]byte("c")); err != nil || string(got) != "new" {
+				t.Errorf("Put after Sweep: got %q (%v)", got, err)
+			}
+		})
+	}
+}
+
+// TestFileNodeStoreReopen 重新打开文件时只保留完整的记录
+func TestFileNodeStoreReopen(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(path string, size int64) error
+		want    []string // 重新打开后仍然存在的节点
+	}{
+		{"intact", func(string, int64) error { return nil }, []string{"a", "b"}},
+		{"torn tail", func(path string, size int64) error { return os.Truncate(path, size-3) }, []string{"a"}},
+		{"garbage tail", func(path string, _ int64) error {
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.Write([]byte{32, 0xFF, 0xFF, 0xFF, 0xFF})
+			return err
+		}, []string{"a", "b"}},
+		{"flipped byte", func(path string, size int64) error {
+			f, err := os.OpenFile(path, os.O_RDWR, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.WriteAt([]byte{0xFF}, size-6)
+			return err
+		}, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "nodes.db")
+			store, err := OpenFileNodeStore(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, h := range []string{"a", "b"} {
+				if err := store.Put([]byte(h), []byte("value-"+h)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			store.Close()
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.corrupt(path, info.Size()); err != nil {
+				t.Fatal(err)
+			}
+
+			store = openFileStore(t, path)
+			for _, h := range []string{"a", "b"} {
+				_, err := store.Get([]byte(h))
+				if want := slices.Contains(tt.want, h); (err == nil) != want {
+					t.Errorf("node %s: got %v, want present=%v", h, err, want)
+				}
+			}
+			// 截断之后追加的记录在下一次打开时仍然完整
+			if err := store.Put([]byte("c"), []byte("value-c")); err != nil {
+				t.Fatal(err)
+			}
+			store.Close()
+			if got, err := openFileStore(t, path).Get([]byte("c")); err != nil || string(got) != "value-c" {
+				t.Errorf("record written after recovery: got %q (%v)", got, err)
+			}
+		})
+	}
+}
+
+func TestTreeWithNodeStore(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"shortcut", []Option{WithShortcutLeaves()}},
+		{"sums", []Option{WithSums(), WithShortcutLeaves()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fill := func(tree *SparseMerkleTree) {
+				for i := 0; i < 100; i++ {
+					value := []byte(fmt.Sprint(i))
+					if tree.sum {
+						value = SumValue(uint64(i), value)
+					}
+					if err := tree.Update([]byte(fmt.Sprintf("account%d", i)), value); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			memory := NewSparseMerkleTree(256, tt.opts...)
+			fill(memory)
+
+			path := filepath.Join(t.TempDir(), "nodes.db")
+			store, err := OpenFileNodeStore(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := NewSparseMerkleTree(256, append([]Option{WithNodeStore(store)}, tt.opts...)...)
+			fill(tree)
+			if _, err := tree.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			root := tree.GetRoot()
+			store.Close()
+			if !bytes.Equal(root, memory.GetRoot()) {
+				t.Fatal("root differs from the same tree built in memory")
+			}
+
+			store = openFileStore(t, path)
+			reopened := NewSparseMerkleTree(256, append([]Option{WithNodeStore(store), WithRoot(root)}, tt.opts...)...)
+			if !bytes.Equal(reopened.GetRoot(), root) {
+				t.Fatalf("root: got %x, want %x", reopened.GetRoot(), root)
+			}
+			if n, err := reopened.Len(); err != nil || n != 100 {
+				t.Errorf("Len: got %d (%v), want 100", n, err)
+			}
+			// 重新打开后继续写入并提交
+			if _, err := reopened.Delete([]byte("account0")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := reopened.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if _, found, err := reopened.Get([]byte("account0")); err != nil || found {
+				t.Errorf("deleted key: found=%v (%v)", found, err)
+			}
+		})
+	}
+}
+
+// TestLegacyNodeStore 旧布局与节点存储的组合在创建树时就被拒绝
+func TestLegacyNodeStore(t *testing.T) {
+	t.Run("new", func(t *testing.T) {
+		defer func() {
+			if err, _ := recover().(error); !errors.Is(err, ErrLegacyNodeStore) {
+				t.Errorf("got panic %v, want ErrLegacyNodeStore", err)
+			}
+		}()
+		NewSparseMerkleTree(256, WithLegacyHashing(), WithNodeStore(NewMemoryNodeStore()))
+	})
+	t.Run("open", func(t *testing.T) {
+		journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer journal.Close()
+		_, err = OpenSparseMerkleTree(256, journal, WithLegacyHashing(), WithNodeStore(NewMemoryNodeStore()))
+		if !errors.Is(err, ErrLegacyNodeStore) {
+			t.Errorf("got %v, want ErrLegacyNodeStore", err)
+		}
+	})
+	t.Run("snapshot", func(t *testing.T) {
+		tree := NewSparseMerkleTree(256, WithLegacyHashing())
+		if err := tree.Update([]byte("alice"), []byte("100")); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tree.WriteSnapshot(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadSnapshot(&buf, WithNodeStore(NewMemoryNodeStore())); !errors.Is(err, ErrLegacyNodeStore) {
+			t.Errorf("got %v, want ErrLegacyNodeStore", err)
+		}
+	})
+}
+
+// TestCorruptNode 存储返回的编码与请求的哈希不符时，加载失败而不是使用错误的节点
+func TestCorruptNode(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(store *MemoryNodeStore, root []byte, leaf []byte)
+	}{
+		{"other node", func(store *MemoryNodeStore, root, leaf []byte) {
+			store.nodes[string(root)] = store.nodes[string(leaf)]
+		}},
+		{"changed value", func(store *MemoryNodeStore, _, leaf []byte) {
+			data := bytes.Clone(store.nodes[string(leaf)])
+			data[len(data)-1] ^= 0x01
+			store.nodes[string(leaf)] = data
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryNodeStore()
+			tree := NewSparseMerkleTree(256, WithShortcutLeaves(), WithNodeStore(store))
+			for i := 0; i < 10; i++ {
+				if err := tree.Update([]byte(fmt.Sprintf("account%d", i)), []byte(fmt.Sprint(i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := tree.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			proof, err := tree.GenerateProof([]byte("account3"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 捷径叶子保存在证明路径的终点，它的哈希是以该层为根的子树哈希
+			leaf := tree.hashLeaf(tree.hashKey([]byte("account3")), tree.hashValue([]byte("3")))
+			leaf = tree.foldLeaf(tree.hashKey([]byte("account3")), leaf, len(proof.Path), 256, tree.defaults)
+			if _, err := store.Get(leaf); err != nil {
+				t.Fatal(err)
+			}
+			tt.corrupt(store, tree.GetRoot(), leaf)
+
+			reopened := NewSparseMerkleTree(256, WithShortcutLeaves(), WithNodeStore(store), WithRoot(tree.GetRoot()))
+			if _, _, err := reopened.Get([]byte("account3")); !errors.Is(err, ErrCorruptNode) {
+				t.Errorf("got %v, want ErrCorruptNode", err)
+			}
+		})
+	}
+}
+
+// TestFileNodeStoreSweepFailure rename 之后的步骤失败时，存储要么切换到新文件，要么拒绝之后的所有操作
+func TestFileNodeStoreSweepFailure(t *testing.T) {
+	tests := []struct {
+		point  string
+		failed bool // 存储是否进入失败状态
+	}{
+		{faultSweepSyncDir, false},
+		{faultSweepReopen, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.point, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "nodes.db")
+			store := openFileStore(t, path)
+			for _, h := range []string{"a", "b"} {
+				if err := store.Put([]byte(h), []byte("value-"+h)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			injected := errors.New("injected")
+			store.fault = func(point string) error {
+				if point == tt.point {
+					return injected
+				}
+				return nil
+			}
+			_, _, err := store.Sweep(func(hash []byte) bool { return string(hash) == "a" })
+			if err == nil {
+				t.Fatal("Sweep succeeded")
+			}
+			store.fault = nil
+
+			if tt.failed {
+				if !errors.Is(err, ErrStoreFailed) {
+					t.Errorf("Sweep: got %v, want ErrStoreFailed", err)
+				}
+				if _, err := store.Get([]byte("a")); !errors.Is(err, ErrStoreFailed) {
+					t.Errorf("Get: got %v, want ErrStoreFailed", err)
+				}
+				if err := store.Put([]byte("c"), []byte("value-c")); !errors.Is(err, ErrStoreFailed) {
+					t.Errorf("Put: got %v, want ErrStoreFailed", err)
+				}
+				return
+			}
+			// 已经切换到新文件：写入的记录在重新打开后仍然存在
+			if err := store.Put([]byte("c"), []byte("value-c")); err != nil {
+				t.Fatal(err)
+			}
+			store.Close()
+			reopened := openFileStore(t, path)
+			for h, want := range map[string]bool{"a": true, "b": false, "c": true} {
+				if _, err := reopened.Get([]byte(h)); (err == nil) != want {
+					t.Errorf("node %s after reopen: got %v, want present=%v", h, err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package exercise
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+var (
+	// ErrInvalidAmount 求和树中的值不包含合法的金额
+	ErrInvalidAmount = errors.New("smt: value does not carry a valid amount")
+	// ErrSumOverflow 写入后树的总额超出 uint64 的范围
+	ErrSumOverflow = errors.New("smt: sum overflows uint64")
+)
+
+// sumSize 哈希后附带的总额的长度（uint64，大端）
+const sumSize = 8
+
+// WithSums 把树配置为求和树（Merkle sum tree），用于储备金证明等场景
+// 求和树中每个值的前 8 字节是大端编码的金额（见 SumValue），
+// 每个节点的哈希后附带它下面所有金额的总和，并且总和本身也参与父节点的哈希:
+//   叶子:     H(0x00 || keyHash || valueHash) || amount
+//   内部节点: H(0x01 || left || right) || (sum(left) + sum(right))
+//   空子树:   总额为 0
+// 其中 valueHash = H(value) || amount；因此根哈希的最后 8 字节就是全树的总额（见 RootSum），
+// 证明中的兄弟节点同样携带总额，验证者可以同时检查存在性和总额（见 VerifySumProof）
+// 金额是无符号的，不存在负数；任何一层的总和溢出时，写入返回 ErrSumOverflow，验证返回 false
+// 注意:
+//   求和树总是使用域分离布局，会忽略 WithLegacyHashing；求和树与普通树的根哈希不兼容
+func WithSums() Option {
+	return func(c *treeConfig) {
+		c.sum = true
+	}
+}
+
+// SumValue 构造求和树中的值
+// 参数:
+//   amount: 金额
+//   data: 附带的数据（可以为空），例如账户信息
+// 返回:
+//   amount 的 8 字节大端编码 || data
+func SumValue(amount uint64, data []byte) []byte {
+	return append(binary.BigEndian.AppendUint64(make([]byte, 0, sumSize+len(data)), amount), data...)
+}
+
+// SumValueBig 用任意精度整数构造求和树中的值
+// 金额为负数或超出 uint64 的范围时返回 ErrInvalidAmount
+func SumValueBig(amount *big.Int, data []byte) ([]byte, error) {
+	if amount == nil || amount.Sign() < 0 || !amount.IsUint64() {
+		return nil, ErrInvalidAmount
+	}
+	return SumValue(amount.Uint64(), data), nil
+}
+
+// ParseSumValue 拆分求和树中的值
+// 返回:
+//   金额和附带的数据；值短于 8 字节时返回 ErrInvalidAmount
+func ParseSumValue(value []byte) (amount uint64, data []byte, err error) {
+	if len(value) < sumSize {
+		return 0, nil, ErrInvalidAmount
+	}
+	return binary.BigEndian.Uint64(value), value[sumSize:], nil
+}
+
+// RootSum 返回求和树的根哈希中记录的总额
+// 根哈希本身由验证者信任（或已经通过证明验证），因此这里只做拆分
+func RootSum(root []byte) (uint64, error) {
+	if len(root) <= sumSize {
+		return 0, ErrInvalidAmount
+	}
+	return binary.BigEndian.Uint64(root[len(root)-sumSize:]), nil
+}
+
+// Sum 返回求和树当前的总额；不是求和树时返回 ErrInvalidAmount
+func (smt *SparseMerkleTree) Sum() (uint64, error) {
+	if !smt.sum {
+		return 0, ErrInvalidAmount
+	}
+	return RootSum(smt.GetRoot())
+}
+
+// Sum 返回该版本的总额，见 SparseMerkleTree.Sum
+func (s *Snapshot) Sum() (uint64, error) {
+	return s.tree.Sum()
+}
+
+// VerifySumProof 无状态地验证求和树的存在性证明，并检查根的总额
+// 参数:
+//   root: 验证者信任的根哈希
+//   supply: 声明的总供应量，必须与根中记录的总额相等
+//   key, value: 要验证的键值对，value 的前 8 字节为金额
+//   proof: 由求和树的 GenerateProof 生成的存在性证明
+//   opts: 生成证明的树所使用的其他配置（WithSums 会自动加上）
+// 返回:
+//   true 表示键值对存在于 root 对应的树中，且全树的总额等于 supply；
+//   证明中任何一层的总和溢出、金额缺失或被篡改时返回 false
+func VerifySumProof(root []byte, supply uint64, key, value []byte, proof *Proof, opts ...Option) bool {
+	c := newTreeConfig(append(opts[:len(opts):len(opts)], WithSums()))
+	total, err := RootSum(root)
+	if err != nil || total != supply || len(root) != c.digestSize() {
+		return false
+	}
+	return c.verifyProof(root, key, value, proof)
+}
+
+// digestSize 节点哈希的长度：求和树中为哈希长度加上总额的长度
+func (c *treeConfig) digestSize() int {
+	if c.sum {
+		return c.hasher.Size() + sumSize
+	}
+	return c.hasher.Size()
+}
+
+// hashValue 计算值的哈希
+// 求和树中为 H(value) || amount，使得只知道值哈希的验证者（例如不存在性证明中占用槽位的叶子）
+// 也能得到该叶子的金额；值中没有金额时返回 nil，由此计算出的哈希不会与任何根相等
+func (c *treeConfig) hashValue(value []byte) []byte {
+	if !c.sum {
+		return c.hasher.Hash(value)
+	}
+	if len(value) < sumSize {
+		return nil
+	}
+	return append(c.hasher.Hash(value), value[:sumSize]...)
+}
+
+// sumLeaf 计算求和树的叶子哈希，valueHash 必须来自 hashValue
+// 参数不合法时返回 nil（见 sumNodes）
+func (c *treeConfig) sumLeaf(keyHash, valueHash []byte) []byte {
+	amount, ok := c.digestSum(valueHash)
+	if !ok {
+		return nil
+	}
+	return appendSum(c.hasher.Hash(leafPrefix, keyHash, valueHash), amount)
+}
+
+// sumNodes 合并求和树中两个子节点的哈希
+// 任意一侧不是合法的哈希，或者两侧的总额相加溢出时返回 nil；
+// nil 与任何哈希合并的结果仍是 nil，因此会一直传递到根：
+// 写入时根为 nil 说明总额溢出（见 checkSum），验证时计算出的根不会与信任的根相等
+func (c *treeConfig) sumNodes(left, right []byte) []byte {
+	l, okL := c.digestSum(left)
+	r, okR := c.digestSum(right)
+	if !okL || !okR || l+r < l {
+		return nil
+	}
+	return appendSum(c.hasher.Hash(nodePrefix, left, right), l+r)
+}
+
+// digestSum 取出求和树哈希中附带的总额，长度不对时 ok 为 false
+func (c *treeConfig) digestSum(digest []byte) (uint64, bool) {
+	if len(digest) != c.hasher.Size()+sumSize {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(digest[len(digest)-sumSize:]), true
+}
+
+// appendSum 在哈希后附加总额
+func appendSum(hash []byte, sum uint64) []byte {
+	return binary.BigEndian.AppendUint64(hash, sum)
+}
+
+// checkAmount 检查求和树中要写入的值是否带有金额
+func (smt *SparseMerkleTree) checkAmount(value []byte) error {
+	if smt.sum && len(value) < sumSize {
+		return ErrInvalidAmount
+	}
+	return nil
+}
+
+// checkSum 检查写入后的新根：求和树中根的哈希为 nil 说明某一层的总额溢出（见 sumNodes）
+func (smt *SparseMerkleTree) checkSum(root *Node) error {
+	if smt.sum && root != nil && root.hash == nil {
+		return ErrSumOverflow
+	}
+	return nil
+}
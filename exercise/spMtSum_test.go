@@ -0,0 +1,166 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// newReserveTree 返回包含三个账户的求和树，总额为 1000
+func newReserveTree(t *testing.T) *SparseMerkleTree {
+	t.Helper()
+	tree := NewSparseMerkleTree(256, WithSums(), WithShortcutLeaves())
+	if err := tree.UpdateBatch([]KeyValue{
+		{Key: []byte("alice"), Value: SumValue(150, nil)},
+		{Key: []byte("bob"), Value: SumValue(250, nil)},
+		{Key: []byte("carol"), Value: SumValue(600, []byte("vip"))},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestVerifySumProof(t *testing.T) {
+	tree := newReserveTree(t)
+	root := tree.GetRoot()
+	supply, err := tree.Sum()
+	if err != nil || supply != 1000 {
+		t.Fatalf("sum: got %d (%v), want 1000", supply, err)
+	}
+	proof, err := tree.GenerateProof([]byte("bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		supply uint64
+		key    string
+		value  []byte
+		mutate func(*Proof) *Proof
+		want   bool
+	}{
+		{name: "valid", supply: 1000, key: "bob", value: SumValue(250, nil), want: true},
+		{name: "understated supply", supply: 900, key: "bob", value: SumValue(250, nil)},
+		{name: "overstated supply", supply: 1100, key: "bob", value: SumValue(250, nil)},
+		{name: "wrong amount", supply: 1000, key: "bob", value: SumValue(150, nil)},
+		{name: "wrong key", supply: 1000, key: "alice", value: SumValue(250, nil)},
+		{name: "missing amount", supply: 1000, key: "bob", value: []byte{1}},
+		{
+			// 把一个兄弟节点的总额改为 0，重新算出的根与声明的根不一致
+			name: "sibling sum", supply: 1000, key: "bob", value: SumValue(250, nil),
+			mutate: func(p *Proof) *Proof {
+				q := *p
+				q.Siblings = append([][]byte(nil), p.Siblings...)
+				for i, s := range q.Siblings {
+					if s != nil {
+						q.Siblings[i] = appendSum(bytes.Clone(s[:len(s)-sumSize]), 0)
+						break
+					}
+				}
+				return &q
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := proof
+			if tt.mutate != nil {
+				p = tt.mutate(proof)
+			}
+			if got := VerifySumProof(root, tt.supply, []byte(tt.key), tt.value, p, WithShortcutLeaves()); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSumWrites(t *testing.T) {
+	update := func(key string, value []byte) func(*SparseMerkleTree) error {
+		return func(tree *SparseMerkleTree) error { return tree.Update([]byte(key), value) }
+	}
+	tests := []struct {
+		name  string
+		write func(*SparseMerkleTree) error
+		err   error
+		sum   uint64
+	}{
+		{"new account", update("dave", SumValue(1, nil)), nil, 1001},
+		{"update balance", update("bob", SumValue(0, nil)), nil, 750},
+		{"delete account", func(tree *SparseMerkleTree) error {
+			_, err := tree.Delete([]byte("carol"))
+			return err
+		}, nil, 400},
+		{"missing amount", update("dave", []byte("1")), ErrInvalidAmount, 1000},
+		{"overflow", update("mallory", SumValue(^uint64(0), nil)), ErrSumOverflow, 1000},
+		{"batch overflow", func(tree *SparseMerkleTree) error {
+			return tree.UpdateBatch([]KeyValue{
+				{Key: []byte("dave"), Value: SumValue(1, nil)},
+				{Key: []byte("mallory"), Value: SumValue(^uint64(0)-1000, nil)},
+			})
+		}, ErrSumOverflow, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newReserveTree(t)
+			before := tree.GetRoot()
+			err := tt.write(tree)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil && !bytes.Equal(tree.GetRoot(), before) {
+				t.Error("failed write changed the root")
+			}
+			if sum, _ := tree.Sum(); sum != tt.sum {
+				t.Errorf("sum: got %d, want %d", sum, tt.sum)
+			}
+		})
+	}
+}
+
+func TestSumValueBig(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount *big.Int
+		err    error
+	}{
+		{"zero", big.NewInt(0), nil},
+		{"max", new(big.Int).SetUint64(^uint64(0)), nil},
+		{"negative", big.NewInt(-1), ErrInvalidAmount},
+		{"too large", new(big.Int).Lsh(big.NewInt(1), 64), ErrInvalidAmount},
+		{"nil", nil, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := SumValueBig(tt.amount, []byte("data"))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			amount, data, err := ParseSumValue(value)
+			if err != nil || amount != tt.amount.Uint64() || string(data) != "data" {
+				t.Errorf("round trip: got %d, %q, %v", amount, data, err)
+			}
+		})
+	}
+}
+
+// TestVerifySumProofKeepsOptions 验证时追加的 WithSums 不能写进调用者的切片
+func TestVerifySumProofKeepsOptions(t *testing.T) {
+	tree := newReserveTree(t)
+	proof, err := tree.GenerateProof([]byte("bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := make([]Option, 1, 2)
+	opts[0] = WithShortcutLeaves()
+	if !VerifySumProof(tree.GetRoot(), 1000, []byte("bob"), SumValue(250, nil), proof, opts...) {
+		t.Fatal("proof does not verify")
+	}
+	if extra := opts[:2][1]; extra != nil {
+		t.Error("VerifySumProof wrote into the caller's option slice")
+	}
+}
@@ -0,0 +1,334 @@
+package exercise
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	// ErrCodec 编码或解码失败（例如数据长度不对、不是规范编码）
+	ErrCodec = errors.New("smt: codec error")
+	// ErrInvalidProof 证明无效
+	ErrInvalidProof = errors.New("smt: invalid proof")
+)
+
+// Codec 把类型 T 与字节数组互相转换
+// 用作键的编码必须是确定的：相等的键总是编码为相同的字节，否则同一个键会落到不同的位置
+// 实现必须可以被多个 goroutine 同时调用
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)    // 编码
+	Decode(data []byte) (T, error) // 解码，data 不是合法的编码时返回错误
+}
+
+// 常用的编码
+var (
+	StringCodec Codec[string]   = stringCodec{} // 字符串，按 UTF-8 字节原样存储
+	BytesCodec  Codec[[]byte]   = bytesCodec{}  // 字节数组，原样存储
+	BigIntCodec Codec[*big.Int] = bigIntCodec{} // 任意精度整数，见 bigIntCodec
+)
+
+type stringCodec struct{}
+
+func (stringCodec) Encode(v string) ([]byte, error) {
+	return []byte(v), nil
+}
+
+func (stringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+type bytesCodec struct{}
+
+func (bytesCodec) Encode(v []byte) ([]byte, error) {
+	return v, nil
+}
+
+func (bytesCodec) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// FixedInteger 固定宽度的整数类型
+type FixedInteger interface {
+	~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// IntCodec 返回固定宽度整数的大端编码
+// 编码长度等于类型的宽度（例如 uint64 为 8 字节），有符号数按补码存储
+// 只有无符号类型的字节序与数值顺序一致（负数的补码大于所有非负数），有序的键（见 WithRawKeys）应使用无符号类型
+// 示例:
+//   balances := NewTypedSMT(tree, StringCodec, IntCodec[uint64]())
+func IntCodec[T FixedInteger]() Codec[T] {
+	return intCodec[T]{width: binary.Size(T(0))}
+}
+
+// intCodec 固定宽度整数的大端编码
+type intCodec[T FixedInteger] struct {
+	width int // 编码长度（字节）
+}
+
+func (c intCodec[T]) Encode(v T) ([]byte, error) {
+	buf := binary.BigEndian.AppendUint64(nil, uint64(v))
+	return buf[8-c.width:], nil
+}
+
+func (c intCodec[T]) Decode(data []byte) (T, error) {
+	if len(data) != c.width {
+		return 0, fmt.Errorf("%w: integer needs %d bytes, got %d", ErrCodec, c.width, len(data))
+	}
+	var buf [8]byte
+	copy(buf[8-c.width:], data)
+	u := binary.BigEndian.Uint64(buf[:])
+	var zero T
+	if zero-1 < zero {
+		// 有符号类型：把最高位扩展到 64 位
+		shift := 64 - 8*c.width
+		return T(int64(u<<shift) >> shift), nil
+	}
+	return T(u), nil
+}
+
+// bigIntCodec 任意精度整数的编码
+// 格式: 符号（0 为非负，1 为负）| 绝对值的大端字节（不含前导零，零的绝对值为空）
+// 每个数只有唯一的编码，因此也可以用作键；解码时拒绝非规范的编码
+type bigIntCodec struct{}
+
+func (bigIntCodec) Encode(v *big.Int) ([]byte, error) {
+	if v == nil {
+		return nil, fmt.Errorf("%w: nil *big.Int", ErrCodec)
+	}
+	sign := byte(0)
+	if v.Sign() < 0 {
+		sign = 1
+	}
+	return append([]byte{sign}, v.Bytes()...), nil
+}
+
+func (bigIntCodec) Decode(data []byte) (*big.Int, error) {
+	if len(data) == 0 || data[0] > 1 {
+		return nil, fmt.Errorf("%w: invalid big.Int sign", ErrCodec)
+	}
+	magnitude := data[1:]
+	if len(magnitude) > 0 && magnitude[0] == 0 {
+		return nil, fmt.Errorf("%w: big.Int with leading zeros", ErrCodec)
+	}
+	if data[0] == 1 && len(magnitude) == 0 {
+		return nil, fmt.Errorf("%w: negative zero", ErrCodec)
+	}
+	v := new(big.Int).SetBytes(magnitude)
+	if data[0] == 1 {
+		v.Neg(v)
+	}
+	return v, nil
+}
+
+// JSONCodec 返回使用 encoding/json 的编码，适用于任意可以序列化为 JSON 的类型
+// encoding/json 对同一个值的编码是确定的（map 按键排序），因此也可以用作键
+func JSONCodec[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+type jsonCodec[T any] struct{}
+
+func (jsonCodec[T]) Encode(v T) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCodec, err)
+	}
+	return data, nil
+}
+
+func (jsonCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("%w: %w", ErrCodec, err)
+	}
+	return v, nil
+}
+
+// BinaryCodec 返回使用 encoding/binary 的大端定长编码
+// 适用于只包含定宽数值、布尔值和定长数组的结构体（例如 struct{ Nonce uint64; Balance [32]byte }），
+// 编码紧凑且唯一；其他类型在编码时返回错误
+func BinaryCodec[T any]() Codec[T] {
+	return binaryCodec[T]{}
+}
+
+type binaryCodec[T any] struct{}
+
+func (binaryCodec[T]) Encode(v T) ([]byte, error) {
+	data, err := binary.Append(nil, binary.BigEndian, v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCodec, err)
+	}
+	return data, nil
+}
+
+func (binaryCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	n, err := binary.Decode(data, binary.BigEndian, &v)
+	if err != nil {
+		return v, fmt.Errorf("%w: %w", ErrCodec, err)
+	}
+	if n != len(data) {
+		return v, fmt.Errorf("%w: %d trailing bytes", ErrCodec, len(data)-n)
+	}
+	return v, nil
+}
+
+// TypedSMT 带类型的稀疏默克尔树
+// 在 SparseMerkleTree 之上用 Codec 完成键和值的编码与解码，调用者不需要自己处理 []byte
+// 底层的树可以通过 Tree 取得，用于提交版本、生成多键证明等；两者看到的是同一份数据
+// 与底层的树一样，可以被多个读 goroutine 和一个写 goroutine 同时使用
+type TypedSMT[K, V any] struct {
+	tree   *SparseMerkleTree // 底层的树
+	keys   Codec[K]          // 键的编码
+	values Codec[V]          // 值的编码
+}
+
+// NewTypedSMT 在已有的树上创建带类型的视图
+// 参数:
+//   tree: 底层的树（可以是新建的，也可以是已经包含数据的）
+//   keys: 键的编码，必须是确定的
+//   values: 值的编码
+// 示例:
+//   accounts := NewTypedSMT(NewSparseMerkleTree(256), StringCodec, JSONCodec[Account]())
+func NewTypedSMT[K, V any](tree *SparseMerkleTree, keys Codec[K], values Codec[V]) *TypedSMT[K, V] {
+	return &TypedSMT[K, V]{tree: tree, keys: keys, values: values}
+}
+
+// Tree 返回底层的树
+func (t *TypedSMT[K, V]) Tree() *SparseMerkleTree {
+	return t.tree
+}
+
+// Get 获取键对应的值
+// 返回:
+//   value: 解码后的值；键不存在时为零值
+//   found: 键是否存在
+//   err: 编码键、解码值或加载节点失败时的错误
+func (t *TypedSMT[K, V]) Get(key K) (value V, found bool, err error) {
+	k, err := t.keys.Encode(key)
+	if err != nil {
+		return value, false, err
+	}
+	data, found, err := t.tree.Get(k)
+	if err != nil || !found {
+		return value, false, err
+	}
+	value, err = t.values.Decode(data)
+	return value, err == nil, err
+}
+
+// Update 更新或插入键值对，见 SparseMerkleTree.Update
+func (t *TypedSMT[K, V]) Update(key K, value V) error {
+	k, err := t.keys.Encode(key)
+	if err != nil {
+		return err
+	}
+	v, err := t.values.Encode(value)
+	if err != nil {
+		return err
+	}
+	return t.tree.Update(k, v)
+}
+
+// Delete 删除键，见 SparseMerkleTree.Delete
+func (t *TypedSMT[K, V]) Delete(key K) (bool, error) {
+	k, err := t.keys.Encode(key)
+	if err != nil {
+		return false, err
+	}
+	return t.tree.Delete(k)
+}
+
+// GetRoot 返回底层树的根哈希
+func (t *TypedSMT[K, V]) GetRoot() []byte {
+	return t.tree.GetRoot()
+}
+
+// TypedProof 带值的证明
+// 与 Proof 不同，它同时携带了被证明的值，验证者不需要事先知道值，验证通过后直接得到解码后的值
+type TypedProof struct {
+	Proof *Proof // 存在性或不存在性证明（见 Proof.Exists）
+	Value []byte // 编码后的值；不存在性证明中为 nil
+}
+
+// Prove 为键生成带值的证明
+// 值和证明取自同一个根（见 SparseMerkleTree.View），即使同时有写操作也保持一致
+// 返回:
+//   proof: 带值的证明；键不存在时为不存在性证明
+//   root: 证明所针对的根哈希
+//   err: 编码键或加载节点失败时的错误
+func (t *TypedSMT[K, V]) Prove(key K) (proof *TypedProof, root []byte, err error) {
+	k, err := t.keys.Encode(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	view := t.tree.View()
+	value, found, err := view.Get(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := view.GenerateProof(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	proof = &TypedProof{Proof: p}
+	if found {
+		proof.Value = value
+	}
+	return proof, view.GetRoot(), nil
+}
+
+// VerifyProof 用给定的根验证带值的证明，见包级函数 VerifyTypedProof
+// 额外检查证明的深度与树的深度一致
+func (t *TypedSMT[K, V]) VerifyProof(root []byte, key K, proof *TypedProof) (V, bool, error) {
+	if proof != nil && proof.Proof != nil && proof.Proof.Depth != t.tree.depth {
+		var zero V
+		return zero, false, ErrInvalidProof
+	}
+	return verifyTypedProof(&t.tree.treeConfig, root, key, proof, t.keys, t.values)
+}
+
+// VerifyTypedProof 无状态地验证带值的证明，并返回解码后的值
+// 参数:
+//   root: 验证者信任的根哈希
+//   key: 要验证的键
+//   proof: 由 TypedSMT.Prove 生成的证明
+//   keys, values: 与生成证明的 TypedSMT 相同的编码
+//   opts: 生成证明的树所使用的配置（例如 WithHasher），必须与树一致
+// 返回:
+//   value: 键对应的值；键不存在时为零值
+//   exists: 键是否存在于 root 对应的树中
+//   err: 证明无效时返回 ErrInvalidProof，值无法解码时返回 ErrCodec
+func VerifyTypedProof[K, V any](root []byte, key K, proof *TypedProof, keys Codec[K], values Codec[V], opts ...Option) (value V, exists bool, err error) {
+	c := newTreeConfig(opts)
+	return verifyTypedProof(&c, root, key, proof, keys, values)
+}
+
+// verifyTypedProof 使用给定配置验证带值的证明，是 VerifyTypedProof 的内部实现
+func verifyTypedProof[K, V any](c *treeConfig, root []byte, key K, proof *TypedProof, keys Codec[K], values Codec[V]) (value V, exists bool, err error) {
+	if proof == nil || proof.Proof == nil {
+		return value, false, ErrInvalidProof
+	}
+	k, err := keys.Encode(key)
+	if err != nil {
+		return value, false, err
+	}
+	if !proof.Proof.Exists {
+		if proof.Value != nil || !c.verifyNonInclusionProof(root, k, proof.Proof) {
+			return value, false, ErrInvalidProof
+		}
+		return value, false, nil
+	}
+	if !c.verifyProof(root, k, proof.Value, proof.Proof) {
+		return value, false, ErrInvalidProof
+	}
+	value, err = values.Decode(proof.Value)
+	if err != nil {
+		return value, false, err
+	}
+	return value, true, nil
+}
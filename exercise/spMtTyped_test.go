@@ -0,0 +1,185 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// roundTrip 编码后再解码，返回解码结果和编码
+func roundTrip[T any](t *testing.T, c Codec[T], v T) (T, []byte) {
+	t.Helper()
+	data, err := c.Encode(v)
+	if err != nil {
+		t.Fatalf("encode %v: %v", v, err)
+	}
+	got, err := c.Decode(data)
+	if err != nil {
+		t.Fatalf("decode %x: %v", data, err)
+	}
+	return got, data
+}
+
+func TestIntCodec(t *testing.T) {
+	t.Run("uint16", func(t *testing.T) {
+		for _, v := range []uint16{0, 1, 0x1234, 0xFFFF} {
+			if got, data := roundTrip(t, IntCodec[uint16](), v); got != v || len(data) != 2 {
+				t.Errorf("%d: got %d (%x)", v, got, data)
+			}
+		}
+	})
+	t.Run("int32", func(t *testing.T) {
+		for _, v := range []int32{0, -1, 1 << 30, -1 << 31} {
+			if got, data := roundTrip(t, IntCodec[int32](), v); got != v || len(data) != 4 {
+				t.Errorf("%d: got %d (%x)", v, got, data)
+			}
+		}
+	})
+	t.Run("int8", func(t *testing.T) {
+		for _, v := range []int8{0, -128, 127, -5} {
+			if got, data := roundTrip(t, IntCodec[int8](), v); got != v || len(data) != 1 {
+				t.Errorf("%d: got %d (%x)", v, got, data)
+			}
+		}
+	})
+	t.Run("wrong length", func(t *testing.T) {
+		if _, err := IntCodec[uint64]().Decode([]byte{1, 2, 3}); !errors.Is(err, ErrCodec) {
+			t.Errorf("got %v, want ErrCodec", err)
+		}
+	})
+}
+
+func TestBigIntCodec(t *testing.T) {
+	huge := new(big.Int).Exp(big.NewInt(10), big.NewInt(30), nil)
+	for _, v := range []*big.Int{big.NewInt(0), big.NewInt(-5), huge, new(big.Int).Neg(huge)} {
+		if got, _ := roundTrip(t, BigIntCodec, v); got.Cmp(v) != 0 {
+			t.Errorf("%s: got %s", v, got)
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad sign", []byte{2, 1}},
+		{"leading zero", []byte{0, 0, 1}},
+		{"negative zero", []byte{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := BigIntCodec.Decode(tt.data); !errors.Is(err, ErrCodec) {
+				t.Errorf("got %v, want ErrCodec", err)
+			}
+		})
+	}
+	if _, err := BigIntCodec.Encode(nil); !errors.Is(err, ErrCodec) {
+		t.Errorf("encode nil: got %v, want ErrCodec", err)
+	}
+}
+
+func TestBinaryCodec(t *testing.T) {
+	type account struct {
+		Nonce   uint64
+		Balance [4]byte
+	}
+	codec := BinaryCodec[account]()
+	v := account{Nonce: 3, Balance: [4]byte{0, 0, 0, 42}}
+	if got, data := roundTrip(t, codec, v); got != v || len(data) != 12 {
+		t.Errorf("got %+v (%x)", got, data)
+	}
+	if _, err := codec.Decode(make([]byte, 13)); !errors.Is(err, ErrCodec) {
+		t.Errorf("trailing bytes: got %v, want ErrCodec", err)
+	}
+	if _, err := BinaryCodec[string]().Encode("x"); !errors.Is(err, ErrCodec) {
+		t.Errorf("variable-size type: got %v, want ErrCodec", err)
+	}
+}
+
+func TestTypedSMT(t *testing.T) {
+	type account struct {
+		Nonce   uint64 `json:"nonce"`
+		Balance string `json:"balance"`
+	}
+	accounts := NewTypedSMT(NewSparseMerkleTree(256), IntCodec[uint32](), JSONCodec[account]())
+	if err := accounts.Update(7, account{Nonce: 3, Balance: "42"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		key    uint32
+		want   account
+		exists bool
+	}{
+		{"present", 7, account{Nonce: 3, Balance: "42"}, true},
+		{"absent", 8, account{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found, err := accounts.Get(tt.key)
+			if err != nil || found != tt.exists || got != tt.want {
+				t.Errorf("Get: got %+v (found=%v, err=%v)", got, found, err)
+			}
+			proof, root, err := accounts.Prove(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, exists, err := accounts.VerifyProof(root, tt.key, proof)
+			if err != nil || exists != tt.exists || got != tt.want {
+				t.Errorf("VerifyProof: got %+v (exists=%v, err=%v)", got, exists, err)
+			}
+			// 证明只对它自己的键有效
+			if _, _, err := accounts.VerifyProof(root, tt.key+1, proof); !errors.Is(err, ErrInvalidProof) {
+				t.Errorf("proof for another key: got %v, want ErrInvalidProof", err)
+			}
+		})
+	}
+
+	if ok, err := accounts.Delete(7); err != nil || !ok {
+		t.Fatalf("Delete: got %v, %v", ok, err)
+	}
+	if !bytes.Equal(accounts.GetRoot(), NewSparseMerkleTree(256).GetRoot()) {
+		t.Error("root after deleting the only key is not the empty root")
+	}
+}
+
+func TestVerifyTypedProofRejected(t *testing.T) {
+	balances := NewTypedSMT(NewSparseMerkleTree(256, WithShortcutLeaves()), StringCodec, BigIntCodec)
+	if err := balances.Update("bob", big.NewInt(-5)); err != nil {
+		t.Fatal(err)
+	}
+	proof, root, err := balances.Prove("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	absent, _, err := balances.Prove("nobody")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		key   string
+		proof *TypedProof
+		want  error
+	}{
+		{"valid", "bob", proof, nil},
+		{"tampered value", "bob", &TypedProof{Proof: proof.Proof, Value: []byte{0, 1}}, ErrInvalidProof},
+		{"value on absence", "nobody", &TypedProof{Proof: absent.Proof, Value: []byte{0}}, ErrInvalidProof},
+		{"missing proof", "bob", &TypedProof{Value: proof.Value}, ErrInvalidProof},
+		{"nil", "bob", nil, ErrInvalidProof},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, _, err := VerifyTypedProof(root, tt.key, tt.proof, StringCodec, BigIntCodec, WithShortcutLeaves())
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err == nil && value.Cmp(big.NewInt(-5)) != 0 {
+				t.Errorf("value: got %s, want -5", value)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package exercise
+
+import (
+	"bytes"
+	"sort"
+)
+
+// UpdateProof 状态转换证明
+// 证明对一组键写入新值之后，树的根哈希从 R1 变为 R2；验证者只需要 R1、R2、写入的键值对和证明，
+// 不需要下载任何一棵树（见 VerifyUpdateProof）
+// 证明的内容是更新前所有被写入的键的多键证明：它描述了覆盖这些键的剪枝子树，
+// 验证者先用它重建 R1，再在同一棵剪枝子树上应用写入，得到 R2
+type UpdateProof struct {
+	Before *MultiProof // 更新前被写入的键的多键证明（针对 R1）
+}
+
+// UpdateBatchWithProof 批量写入键值对，同时生成状态转换证明
+// 参数:
+//   pairs: 要写入的键值对，规则与 UpdateBatch 相同（同一个键出现多次时以最后一次为准）
+// 返回:
+//   proof: 从写入前的根到写入后的根的状态转换证明
+//   err: 与 UpdateBatch 相同；出错时树保持不变，不返回证明
+// 示例:
+//   oldRoot := smt.GetRoot()
+//   proof, err := smt.UpdateBatchWithProof(pairs)
+//   ok := VerifyUpdateProof(oldRoot, smt.GetRoot(), pairs, proof)
+func (smt *SparseMerkleTree) UpdateBatchWithProof(pairs []KeyValue) (*UpdateProof, error) {
+	smt.mu.Lock()
+	defer smt.mu.Unlock()
+	hashes := make([][]byte, 0, len(pairs))
+	for _, p := range pairs {
+		if err := smt.checkKey(p.Key, smt.depth); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, smt.hashKey(p.Key))
+	}
+	hashes = sortUniqueHashes(hashes)
+
+	before := &MultiProof{Depth: smt.depth}
+	if len(hashes) > 0 {
+		if err := smt.generateMultiProof(smt.root, hashes, 0, before); err != nil {
+			return nil, err
+		}
+	}
+	if err := smt.applyBatch(pairs); err != nil {
+		return nil, err
+	}
+	return &UpdateProof{Before: before}, nil
+}
+
+// VerifyUpdateProof 无状态地验证状态转换证明
+// 参数:
+//   oldRoot: 写入前的根哈希 R1
+//   newRoot: 写入后的根哈希 R2
+//   pairs: 写入的键值对，必须与生成证明时相同
+//   proof: 由 UpdateBatchWithProof 生成的证明
+//   opts: 生成证明的树所使用的配置（例如 WithHasher），必须与树一致
+// 返回:
+//   true 表示在根为 R1 的树上执行这些写入恰好得到 R2；
+//   证明、键值对或任意一个根被篡改时返回 false
+func VerifyUpdateProof(oldRoot, newRoot []byte, pairs []KeyValue, proof *UpdateProof, opts ...Option) bool {
+	root, ok := ApplyUpdateProof(oldRoot, pairs, proof, opts...)
+	return ok && bytes.Equal(root, newRoot)
+}
+
+// ApplyUpdateProof 根据状态转换证明计算写入后的根哈希
+// 参数:
+//   oldRoot: 写入前的根哈希 R1
+//   pairs: 写入的键值对
+//   proof: 由 UpdateBatchWithProof 生成的证明
+//   opts: 生成证明的树所使用的配置
+// 返回:
+//   写入后的根哈希 R2；证明与 R1 不符、格式错误，或者写入会发生键冲突时 ok 为 false
+// 工作原理:
+//   按与生成时相同的规则把键分组并遍历证明，每个位置同时计算写入前和写入后的哈希：
+//   - 只有一侧包含被写入的键时，另一侧的兄弟哈希在写入前后保持不变
+//   - 终点处，写入前的哈希由证明中的叶子（或空子树）得到；
+//     写入后的哈希由原有的叶子（未被覆盖时）和落在这里的所有新叶子重新构建
+//   最后写入前的哈希必须等于 R1，这保证了证明描述的确实是 R1 对应的树
+func ApplyUpdateProof(oldRoot []byte, pairs []KeyValue, proof *UpdateProof, opts ...Option) (newRoot []byte, ok bool) {
+	c := newTreeConfig(opts)
+	return c.applyUpdateProof(oldRoot, pairs, proof)
+}
+
+// applyUpdateProof 使用给定配置计算写入后的根哈希，是 ApplyUpdateProof 的内部实现
+func (c *treeConfig) applyUpdateProof(oldRoot []byte, pairs []KeyValue, proof *UpdateProof) ([]byte, bool) {
+	if proof == nil || proof.Before == nil {
+		return nil, false
+	}
+	mp := proof.Before
+	if !c.validDepth(mp.Depth) {
+		return nil, false
+	}
+
+	items := make([]batchItem, 0, len(pairs))
+	for _, p := range pairs {
+		if c.checkKey(p.Key, mp.Depth) != nil {
+			return nil, false
+		}
+		keyHash := c.hashKey(p.Key)
+		items = append(items, batchItem{
+			keyHash:  keyHash,
+			value:    p.Value,
+			leafHash: c.hashLeaf(keyHash, c.hashValue(p.Value)),
+		})
+	}
+	items = sortBatch(items)
+	if len(items) == 0 {
+		// 没有写入：根不变，证明必须为空
+		if len(mp.Terminals) > 0 || len(mp.Leaves) > 0 || len(mp.Siblings) > 0 {
+			return nil, false
+		}
+		return oldRoot, true
+	}
+
+	v := &multiProofVerifier{
+		treeConfig: c,
+		proof:      mp,
+		defaults:   c.defaultHashes(mp.Depth),
+	}
+	oldHash, newHash, ok := v.walkUpdate(items, 0)
+	if !ok {
+		return nil, false
+	}
+	// 证明中的所有内容都必须被用到，不允许夹带多余的数据
+	if v.terminals != len(mp.Terminals) || v.leaves != len(mp.Leaves) || v.siblings != len(mp.Siblings) {
+		return nil, false
+	}
+	if newHash == nil || !bytes.Equal(oldHash, oldRoot) {
+		return nil, false // newHash 为 nil 说明求和树的总额溢出（见 sumNodes）
+	}
+	return newHash, true
+}
+
+// walkUpdate 计算第 depth 层、包含 group 中所有写入的子树在写入前后的哈希
+// 返回写入前和写入后的子树哈希；证明格式错误或写入会发生键冲突时 ok 为 false
+func (v *multiProofVerifier) walkUpdate(group []batchItem, depth int) (oldHash, newHash []byte, ok bool) {
+	if v.terminals >= len(v.proof.Terminals) {
+		return nil, nil, false
+	}
+	terminal := v.proof.Terminals[v.terminals]
+	v.terminals++
+
+	if terminal {
+		if v.leaves >= len(v.proof.Leaves) {
+			return nil, nil, false
+		}
+		leaf := v.proof.Leaves[v.leaves]
+		v.leaves++
+		return v.applyTerminal(group, leaf, depth)
+	}
+
+	if depth >= v.proof.Depth {
+		return nil, nil, false
+	}
+	split := sort.Search(len(group), func(i int) bool {
+		return getBit(group[i].keyHash, depth)
+	})
+	leftOld, leftNew, ok := v.childUpdate(group[:split], depth+1)
+	if !ok {
+		return nil, nil, false
+	}
+	rightOld, rightNew, ok := v.childUpdate(group[split:], depth+1)
+	if !ok {
+		return nil, nil, false
+	}
+	return v.hashNodes(leftOld, rightOld), v.hashNodes(leftNew, rightNew), true
+}
+
+// childUpdate 获取第 depth 层的一个子树在写入前后的哈希：有写入时继续遍历，否则读取兄弟哈希（写入前后相同）
+func (v *multiProofVerifier) childUpdate(group []batchItem, depth int) ([]byte, []byte, bool) {
+	if len(group) > 0 {
+		return v.walkUpdate(group, depth)
+	}
+	hash, ok := v.child(nil, depth)
+	return hash, hash, ok
+}
+
+// applyTerminal 计算终点子树在写入前后的哈希
+func (v *multiProofVerifier) applyTerminal(group []batchItem, leaf MultiProofLeaf, depth int) ([]byte, []byte, bool) {
+	oldHash := v.defaults[v.proof.Depth-depth]
+	items := group
+	if leaf.Key != nil {
+		// 叶子必须与组内的键处在同一条路径上
+		if commonPrefix(leaf.Key, group[0].keyHash, depth) != depth {
+			return nil, nil, false
+		}
+		leafHash := v.hashLeaf(leaf.Key, leaf.ValueHash)
+		oldHash = v.foldLeaf(leaf.Key, leafHash, depth, v.proof.Depth, v.defaults)
+		// 原有的叶子没有被本批覆盖时，它仍然留在这棵子树中
+		items = mergeLeafIntoBatch(group, batchItem{keyHash: leaf.Key, leafHash: leafHash})
+	}
+	newHash, ok := v.subtreeHash(items, depth)
+	return oldHash, newHash, ok
+}
+
+// subtreeHash 计算第 depth 层、只包含 items 中这些叶子的子树的哈希
+// 只有一个叶子时直接折叠（与捷径叶子的哈希相同，两种存储模式的根哈希一致）；
+// 两个叶子到达叶子层仍未分开，说明它们发生了键冲突，树会拒绝这样的写入
+func (v *multiProofVerifier) subtreeHash(items []batchItem, depth int) ([]byte, bool) {
+	switch {
+	case len(items) == 0:
+		return v.defaults[v.proof.Depth-depth], true
+	case len(items) == 1:
+		return v.foldLeaf(items[0].keyHash, items[0].leafHash, depth, v.proof.Depth, v.defaults), true
+	case depth >= v.proof.Depth:
+		return nil, false
+	}
+	split := sort.Search(len(items), func(i int) bool {
+		return getBit(items[i].keyHash, depth)
+	})
+	left, ok := v.subtreeHash(items[:split], depth+1)
+	if !ok {
+		return nil, false
+	}
+	right, ok := v.subtreeHash(items[split:], depth+1)
+	if !ok {
+		return nil, false
+	}
+	return v.hashNodes(left, right), true
+}
@@ -0,0 +1,133 @@
+package exercise
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestVerifyUpdateProof(t *testing.T) {
+	trees := []struct {
+		name  string
+		depth int
+		opts  []Option
+		key   func(i int) []byte
+		value func(s string) []byte
+	}{
+		{
+			name:  "default",
+			depth: 256,
+			key:   func(i int) []byte { return []byte(fmt.Sprintf("account%d", i)) },
+			value: func(s string) []byte { return []byte(s) },
+		},
+		{
+			name:  "shortcut",
+			depth: 256,
+			opts:  []Option{WithShortcutLeaves()},
+			key:   func(i int) []byte { return []byte(fmt.Sprintf("account%d", i)) },
+			value: func(s string) []byte { return []byte(s) },
+		},
+		{
+			name:  "sums",
+			depth: 256,
+			opts:  []Option{WithSums(), WithShortcutLeaves()},
+			key:   func(i int) []byte { return []byte(fmt.Sprintf("account%d", i)) },
+			value: func(s string) []byte { return SumValue(uint64(len(s)), []byte(s)) },
+		},
+		{
+			name:  "raw keys",
+			depth: 64,
+			opts:  []Option{WithRawKeys(), WithShortcutLeaves()},
+			key:   func(i int) []byte { return height(uint64(i)) },
+			value: func(s string) []byte { return []byte(s) },
+		},
+	}
+	batches := []struct {
+		name string
+		keys []int
+	}{
+		{"insert", []int{1000, 1001}},
+		{"overwrite", []int{1, 200}},
+		{"mixed", []int{1, 1000, 150}},
+		{"empty", nil},
+	}
+	for _, tr := range trees {
+		for _, b := range batches {
+			t.Run(tr.name+"/"+b.name, func(t *testing.T) {
+				tree := NewSparseMerkleTree(tr.depth, tr.opts...)
+				for i := 0; i < 256; i++ {
+					if err := tree.Update(tr.key(i), tr.value(fmt.Sprint(i))); err != nil {
+						t.Fatal(err)
+					}
+				}
+				r1 := tree.GetRoot()
+				pairs := make([]KeyValue, len(b.keys))
+				for i, k := range b.keys {
+					pairs[i] = KeyValue{Key: tr.key(k), Value: tr.value("new")}
+				}
+				proof, err := tree.UpdateBatchWithProof(pairs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r2 := tree.GetRoot()
+				if !VerifyUpdateProof(r1, r2, pairs, proof, tr.opts...) {
+					t.Fatal("transition proof does not verify")
+				}
+				if len(pairs) == 0 {
+					return
+				}
+
+				forged := append([]KeyValue(nil), pairs...)
+				forged[len(forged)-1].Value = tr.value("forged")
+				if VerifyUpdateProof(r1, r2, forged, proof, tr.opts...) {
+					t.Error("proof verifies with a changed value")
+				}
+				if VerifyUpdateProof(r1, r2, pairs[1:], proof, tr.opts...) {
+					t.Error("proof verifies with a write missing")
+				}
+				if VerifyUpdateProof(r2, r2, pairs, proof, tr.opts...) {
+					t.Error("proof verifies against the wrong old root")
+				}
+				if root, ok := ApplyUpdateProof(r1, pairs, proof, tr.opts...); !ok || !bytes.Equal(root, r2) {
+					t.Errorf("ApplyUpdateProof: got %x (ok=%v), want %x", root, ok, r2)
+				}
+			})
+		}
+	}
+}
+
+func TestVerifyUpdateProofMalformed(t *testing.T) {
+	tree := NewSparseMerkleTree(256)
+	if err := tree.Update([]byte("alice"), []byte("100")); err != nil {
+		t.Fatal(err)
+	}
+	r1 := tree.GetRoot()
+	pairs := []KeyValue{{Key: []byte("bob"), Value: []byte("50")}}
+	proof, err := tree.UpdateBatchWithProof(pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2 := tree.GetRoot()
+
+	tests := []struct {
+		name  string
+		proof *UpdateProof
+	}{
+		{"nil", nil},
+		{"no multiproof", &UpdateProof{}},
+		{"bad depth", &UpdateProof{Before: &MultiProof{Depth: 1000}}},
+		{"extra sibling", &UpdateProof{Before: &MultiProof{
+			Depth:     proof.Before.Depth,
+			Terminals: proof.Before.Terminals,
+			Leaves:    proof.Before.Leaves,
+			Siblings:  append(append([][]byte(nil), proof.Before.Siblings...), r1),
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if VerifyUpdateProof(r1, r2, pairs, tt.proof) {
+				t.Error("malformed proof verifies")
+			}
+		})
+	}
+}
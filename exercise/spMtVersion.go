@@ -0,0 +1,220 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+	"iter"
+	"sort"
+)
+
+// ErrUnknownVersion 指定的版本不存在（从未提交，或已被 Rollback 或剪除丢弃）
+var ErrUnknownVersion = errors.New("smt: unknown version")
+
+// Version 树的版本号
+// 第一次 Commit 得到版本 1，之后每次 Commit 加一；0 表示还没有提交过任何版本
+type Version uint64
+
+// committedVersion 一个已提交的版本
+type committedVersion struct {
+	version Version // 版本号
+	root    *Node   // 该版本的根节点
+}
+
+// Commit 把当前的树状态提交为一个新版本
+// 由于树是写时复制的，提交只需要记录当前根节点，不会复制任何节点
+// 使用节点存储时，上次提交以来新建的节点会被写入存储（并在存储支持时刷盘），
+// 之后内存中只保留根哈希，节点在访问时重新从存储加载
+// 返回:
+//   新版本的版本号，之后可以用 At 读取该版本，或用 Rollback 回到该版本
+//   写入存储失败时返回错误，此时不会产生新版本，未提交的修改仍然保留在内存中
+func (smt *SparseMerkleTree) Commit() (Version, error) {
+	smt.mu.Lock()
+	defer smt.mu.Unlock()
+	if smt.journal != nil {
+		if err := smt.commitJournal(); err != nil {
+			return 0, err
+		}
+	} else if smt.store != nil {
+		if err := smt.flush(); err != nil {
+			return 0, err
+		}
+	}
+	smt.latest++
+	smt.versions = append(smt.versions, committedVersion{version: smt.latest, root: smt.root})
+	return smt.latest, nil
+}
+
+// commitJournal 按预写日志的顺序提交：封存、写入节点、替换日志（见 Journal）
+// 失败时树可能已经（在磁盘上）提交，也可能没有，需要用 OpenSparseMerkleTree 重新打开
+func (smt *SparseMerkleTree) commitJournal() error {
+	root := smt.hashOf(smt.root, 0)
+	if !smt.journal.dirty && bytes.Equal(root, smt.journal.committed) {
+		return nil // 上次提交之后没有修改
+	}
+	if err := smt.journal.seal(root); err != nil {
+		return err
+	}
+	if err := smt.flush(); err != nil {
+		return err
+	}
+	return smt.journal.checkpoint(root)
+}
+
+// flush 把未保存的节点写入存储，并把根节点替换为占位节点以释放内存
+func (smt *SparseMerkleTree) flush() error {
+	if err := smt.persist(smt.root); err != nil {
+		return err
+	}
+	if err := smt.journal.inject(faultStoreSync); err != nil {
+		return err
+	}
+	if s, ok := smt.store.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil {
+			return err
+		}
+	}
+	if smt.root != nil {
+		smt.root = stubNode(smt.root.hash)
+	}
+	return nil
+}
+
+// LatestVersion 返回最近一次提交的版本号，没有提交过时返回 0
+func (smt *SparseMerkleTree) LatestVersion() Version {
+	smt.mu.RLock()
+	defer smt.mu.RUnlock()
+	return smt.latest
+}
+
+// Rollback 把树回滚到指定版本
+// 用于处理链重组：当前未提交的修改以及该版本之后提交的所有版本都会被丢弃，
+// 之后再次 Commit 得到的版本号为 version+1
+// 使用预写日志时，该版本的根会被记录为最近一次提交的根，日志中未提交的修改一并丢弃
+// 参数:
+//   version: 要回滚到的版本，必须是已提交且未被丢弃的版本
+// 返回:
+//   版本不存在时返回 ErrUnknownVersion，树保持不变
+func (smt *SparseMerkleTree) Rollback(version Version) error {
+	smt.mu.Lock()
+	defer smt.mu.Unlock()
+	i, err := smt.versionIndex(version)
+	if err != nil {
+		return err
+	}
+	root := smt.versions[i].root
+	if smt.journal != nil {
+		if err := smt.journal.checkpoint(smt.hashOf(root, 0)); err != nil {
+			return err
+		}
+	}
+	smt.root = root
+	clear(smt.versions[i+1:]) // 释放对被丢弃版本的引用
+	smt.versions = smt.versions[:i+1]
+	smt.latest = version
+	return nil
+}
+
+// At 返回指定版本的只读视图
+// 视图与树共享节点，之后对树的修改（包括 Rollback）不会影响已经取得的视图；
+// 唯一的例外是使用节点存储时，该版本被 PruneVersions 或 PruneRoots 剪除后，视图无法再加载节点
+// 取得视图之后，在视图上的读操作完全不需要获取树的锁，不会与写操作发生任何争用
+// 参数:
+//   version: 已提交的版本号
+// 返回:
+//   该版本的快照；版本不存在时返回 ErrUnknownVersion
+func (smt *SparseMerkleTree) At(version Version) (*Snapshot, error) {
+	smt.mu.RLock()
+	defer smt.mu.RUnlock()
+	i, err := smt.versionIndex(version)
+	if err != nil {
+		return nil, err
+	}
+	return smt.snapshot(smt.versions[i].root, version), nil
+}
+
+// View 返回树当前状态的只读视图，包括尚未提交的修改
+// 用于需要在同一个根上执行多次读取的场景（例如先读根哈希再生成证明），
+// 视图中的所有读取都针对取得视图那一刻的根，不受之后写操作的影响
+// 视图的 Version 为取得视图时最近一次提交的版本号，视图的内容可能比该版本更新
+func (smt *SparseMerkleTree) View() *Snapshot {
+	smt.mu.RLock()
+	defer smt.mu.RUnlock()
+	return smt.snapshot(smt.root, smt.latest)
+}
+
+// snapshot 创建以 root 为根的只读视图，调用者必须持有锁
+func (smt *SparseMerkleTree) snapshot(root *Node, version Version) *Snapshot {
+	return &Snapshot{
+		tree: &SparseMerkleTree{
+			treeConfig: smt.treeConfig,
+			root:       root,
+			depth:      smt.depth,
+			defaults:   smt.defaults,
+		},
+		version: version,
+	}
+}
+
+// versionIndex 返回已提交版本在 versions 中的位置
+func (smt *SparseMerkleTree) versionIndex(version Version) (int, error) {
+	i := sort.Search(len(smt.versions), func(i int) bool {
+		return smt.versions[i].version >= version
+	})
+	if i == len(smt.versions) || smt.versions[i].version != version {
+		return 0, ErrUnknownVersion
+	}
+	return i, nil
+}
+
+// Snapshot 树在某个已提交版本（或当前状态，见 View）的只读视图
+// 用于在历史区块高度上查询和生成证明，生成的证明针对该版本的根哈希
+// 快照引用的节点不会再改变，因此可以被任意多个 goroutine 同时读取
+type Snapshot struct {
+	tree    *SparseMerkleTree // 以该版本的根节点为根的树，只用于读取
+	version Version           // 快照对应的版本号
+}
+
+// Version 返回快照对应的版本号
+func (s *Snapshot) Version() Version {
+	return s.version
+}
+
+// GetRoot 返回该版本的根哈希
+func (s *Snapshot) GetRoot() []byte {
+	return s.tree.GetRoot()
+}
+
+// Get 在该版本中获取键对应的值，见 SparseMerkleTree.Get
+func (s *Snapshot) Get(key []byte) ([]byte, bool, error) {
+	return s.tree.Get(key)
+}
+
+// GenerateProof 在该版本中生成 Merkle 证明，见 SparseMerkleTree.GenerateProof
+func (s *Snapshot) GenerateProof(key []byte) (*Proof, error) {
+	return s.tree.GenerateProof(key)
+}
+
+// GenerateMultiProof 在该版本中生成多键证明，见 SparseMerkleTree.GenerateMultiProof
+func (s *Snapshot) GenerateMultiProof(keys [][]byte) (*MultiProof, []ProofEntry, error) {
+	return s.tree.GenerateMultiProof(keys)
+}
+
+// Leaves 按键哈希顺序遍历该版本的所有叶子，见 SparseMerkleTree.Leaves
+func (s *Snapshot) Leaves() iter.Seq2[Leaf, error] {
+	return s.tree.Leaves()
+}
+
+// LeavesFrom 从 start 开始按顺序遍历该版本的叶子，见 SparseMerkleTree.LeavesFrom
+func (s *Snapshot) LeavesFrom(start []byte) iter.Seq2[Leaf, error] {
+	return s.tree.LeavesFrom(start)
+}
+
+// LeavesWithPrefix 按顺序遍历该版本中键哈希以 prefix 开头的叶子，见 SparseMerkleTree.LeavesWithPrefix
+func (s *Snapshot) LeavesWithPrefix(prefix []byte) iter.Seq2[Leaf, error] {
+	return s.tree.LeavesWithPrefix(prefix)
+}
+
+// Len 返回该版本中叶子的数量
+func (s *Snapshot) Len() (int, error) {
+	return s.tree.Len()
+}
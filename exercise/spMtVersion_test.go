@@ -0,0 +1,153 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// versionModes 版本相关测试覆盖的树配置
+var versionModes = []struct {
+	name string
+	opts func() []Option
+}{
+	{"memory", func() []Option { return []Option{WithShortcutLeaves()} }},
+	{"node store", func() []Option { return []Option{WithShortcutLeaves(), WithNodeStore(NewMemoryNodeStore())} }},
+}
+
+func TestVersions(t *testing.T) {
+	for _, m := range versionModes {
+		t.Run(m.name, func(t *testing.T) {
+			tree := NewSparseMerkleTree(256, m.opts()...)
+			if tree.LatestVersion() != 0 {
+				t.Fatalf("new tree at version %d", tree.LatestVersion())
+			}
+			// 第 v 个版本中 alice 的值为 v，bob 只在第 2 个版本之后存在
+			roots := map[Version][]byte{}
+			for v := Version(1); v <= 3; v++ {
+				if err := tree.Update([]byte("alice"), []byte(fmt.Sprint(v))); err != nil {
+					t.Fatal(err)
+				}
+				if v == 2 {
+					if err := tree.Update([]byte("bob"), []byte("10")); err != nil {
+						t.Fatal(err)
+					}
+				}
+				got, err := tree.Commit()
+				if err != nil || got != v {
+					t.Fatalf("Commit: got %d (%v), want %d", got, err, v)
+				}
+				roots[v] = tree.GetRoot()
+			}
+			// 未提交的修改不影响任何版本
+			if err := tree.Update([]byte("alice"), []byte("pending")); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				version Version
+				alice   string
+				bob     bool
+			}{
+				{1, "1", false},
+				{2, "2", true},
+				{3, "3", true},
+			}
+			for _, tt := range tests {
+				snap, err := tree.At(tt.version)
+				if err != nil {
+					t.Fatalf("At(%d): %v", tt.version, err)
+				}
+				if snap.Version() != tt.version || !bytes.Equal(snap.GetRoot(), roots[tt.version]) {
+					t.Errorf("version %d: got version %d, root %x", tt.version, snap.Version(), snap.GetRoot())
+				}
+				value, found, err := snap.Get([]byte("alice"))
+				if err != nil || !found || string(value) != tt.alice {
+					t.Errorf("version %d, alice: got %q (found=%v, err=%v)", tt.version, value, found, err)
+				}
+				if _, found, _ := snap.Get([]byte("bob")); found != tt.bob {
+					t.Errorf("version %d, bob: found=%v, want %v", tt.version, found, tt.bob)
+				}
+				proof, err := snap.GenerateProof([]byte("alice"))
+				if err != nil || !VerifyProof(roots[tt.version], []byte("alice"), value, proof, WithShortcutLeaves()) {
+					t.Errorf("version %d: proof does not verify (%v)", tt.version, err)
+				}
+			}
+			for _, v := range []Version{0, 4} {
+				if _, err := tree.At(v); !errors.Is(err, ErrUnknownVersion) {
+					t.Errorf("At(%d): got %v, want ErrUnknownVersion", v, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	for _, m := range versionModes {
+		t.Run(m.name, func(t *testing.T) {
+			tree := NewSparseMerkleTree(256, m.opts()...)
+			if err := tree.Update([]byte("alice"), []byte("100")); err != nil {
+				t.Fatal(err)
+			}
+			v1, _ := tree.Commit()
+			r1 := tree.GetRoot()
+			old, err := tree.At(v1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tree.Update([]byte("bob"), []byte("10")); err != nil {
+				t.Fatal(err)
+			}
+			v2, _ := tree.Commit()
+			if err := tree.Update([]byte("carol"), []byte("5")); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tree.Rollback(v2 + 1); !errors.Is(err, ErrUnknownVersion) {
+				t.Fatalf("Rollback to an unknown version: got %v, want ErrUnknownVersion", err)
+			}
+			if _, found, _ := tree.Get([]byte("carol")); !found {
+				t.Fatal("failed Rollback discarded pending changes")
+			}
+
+			if err := tree.Rollback(v1); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(tree.GetRoot(), r1) || tree.LatestVersion() != v1 {
+				t.Errorf("after Rollback: root %x, version %d", tree.GetRoot(), tree.LatestVersion())
+			}
+			for _, key := range []string{"bob", "carol"} {
+				if _, found, _ := tree.Get([]byte(key)); found {
+					t.Errorf("%s survived the rollback", key)
+				}
+			}
+			if _, err := tree.At(v2); !errors.Is(err, ErrUnknownVersion) {
+				t.Errorf("At(%d) after rollback: got %v, want ErrUnknownVersion", v2, err)
+			}
+			// 回滚前取得的快照不受影响，之后的版本号从回滚的版本继续
+			if _, found, _ := old.Get([]byte("alice")); !found {
+				t.Error("snapshot taken before the rollback lost alice")
+			}
+			if v, err := tree.Commit(); err != nil || v != v1+1 {
+				t.Errorf("Commit after rollback: got %d (%v), want %d", v, err, v1+1)
+			}
+		})
+	}
+}
+
+// TestView 视图固定在取得时的根，包括未提交的修改
+func TestView(t *testing.T) {
+	tree := NewSparseMerkleTree(256)
+	if err := tree.Update([]byte("alice"), []byte("100")); err != nil {
+		t.Fatal(err)
+	}
+	view := tree.View()
+	if err := tree.Update([]byte("alice"), []byte("90")); err != nil {
+		t.Fatal(err)
+	}
+	value, _, err := view.Get([]byte("alice"))
+	if err != nil || string(value) != "100" || view.Version() != 0 {
+		t.Errorf("view: got %q (%v) at version %d", value, err, view.Version())
+	}
+}
@@ -0,0 +1,520 @@
+package exercise
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// TestShortcutLeaves 捷径模式与完整深度的树根哈希相同，证明更短，并且在删除后同样收缩
+func TestShortcutLeaves(t *testing.T) {
+	tests := []struct {
+		name   string
+		depth  int
+		keys   int
+		delete []int
+	}{
+		{"single key", 256, 1, nil},
+		{"many keys", 256, 200, nil},
+		{"delete to one", 256, 3, []int{0, 2}},
+		{"delete all", 256, 5, []int{0, 1, 2, 3, 4}},
+		{"shallow", 32, 50, []int{7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			full := NewSparseMerkleTree(tt.depth)
+			compact := NewSparseMerkleTree(tt.depth, WithShortcutLeaves())
+			for i := 0; i < tt.keys; i++ {
+				key, value := []byte(fmt.Sprintf("account%d", i)), []byte(fmt.Sprint(i))
+				for _, tree := range []*SparseMerkleTree{full, compact} {
+					if err := tree.Update(key, value); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			for _, i := range tt.delete {
+				for _, tree := range []*SparseMerkleTree{full, compact} {
+					if _, err := tree.Delete([]byte(fmt.Sprintf("account%d", i))); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if !bytes.Equal(full.GetRoot(), compact.GetRoot()) {
+				t.Fatalf("shortcut root %x, full root %x", compact.GetRoot(), full.GetRoot())
+			}
+
+			for i := 0; i < tt.keys; i++ {
+				key := []byte(fmt.Sprintf("account%d", i))
+				value, found, err := compact.Get(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				proof, err := compact.GenerateProof(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.depth == 256 && len(proof.Siblings) >= 64 {
+					t.Errorf("%s: shortcut proof has %d siblings", key, len(proof.Siblings))
+				}
+				if found {
+					if !VerifyProof(compact.GetRoot(), key, value, proof, WithShortcutLeaves()) {
+						t.Errorf("%s: inclusion proof does not verify", key)
+					}
+					// 捷径叶子的哈希与完整深度的子树哈希相同，验证者不需要知道树的存储模式
+					if !VerifyProof(full.GetRoot(), key, value, proof) {
+						t.Errorf("%s: shortcut proof does not verify against the full tree", key)
+					}
+				} else if !VerifyNonInclusionProof(compact.GetRoot(), key, proof, WithShortcutLeaves()) {
+					t.Errorf("%s: non-inclusion proof does not verify", key)
+				}
+			}
+		})
+	}
+}
+
+// TestKeyCollision 浅深度的树中落在同一个槽位的键被拒绝，原来的键保持不变，并且可以证明新键不存在
+func TestKeyCollision(t *testing.T) {
+	tests := []struct {
+		name     string
+		depth    int
+		opts     []Option
+		provable bool // 能否证明新键不存在：旧布局的叶子哈希不绑定键，槽位被占用时无法证明（见 bindsLeafKey）
+	}{
+		{"depth 8", 8, nil, true},
+		{"depth 16", 16, nil, true},
+		{"shortcut", 16, []Option{WithShortcutLeaves()}, true},
+		{"legacy", 16, []Option{WithLegacyHashing()}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := collidingKeys(t, tt.depth)
+			tree := NewSparseMerkleTree(tt.depth, tt.opts...)
+			if err := tree.Update(a, []byte("first")); err != nil {
+				t.Fatal(err)
+			}
+			root := tree.GetRoot()
+			if err := tree.Update(b, []byte("second")); !errors.Is(err, ErrKeyCollision) {
+				t.Fatalf("got %v, want ErrKeyCollision", err)
+			}
+			if !bytes.Equal(tree.GetRoot(), root) {
+				t.Error("rejected update changed the root")
+			}
+			if value, found, err := tree.Get(a); err != nil || !found || string(value) != "first" {
+				t.Errorf("first key: got %q (found=%v, err=%v)", value, found, err)
+			}
+			if _, found, err := tree.Get(b); err != nil || found {
+				t.Errorf("colliding key: found=%v (%v)", found, err)
+			}
+			if ok, err := tree.Delete(b); err != nil || ok {
+				t.Errorf("deleting the colliding key: got %v (%v)", ok, err)
+			}
+			// 覆盖同一个键不是冲突
+			if err := tree.Update(a, []byte("again")); err != nil {
+				t.Errorf("overwriting the first key: %v", err)
+			}
+
+			proof, err := tree.GenerateProof(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if proof.Exists || !bytes.Equal(proof.LeafKey, tree.hashKey(a)) {
+				t.Fatalf("proof for the colliding key: exists=%v, leaf key %x", proof.Exists, proof.LeafKey)
+			}
+			if got := tree.VerifyNonInclusionProof(b, proof); got != tt.provable {
+				t.Errorf("non-inclusion proof through an occupied slot: got %v, want %v", got, tt.provable)
+			}
+			if tree.VerifyNonInclusionProof(a, proof) {
+				t.Error("the same proof claims the occupying key is absent")
+			}
+		})
+	}
+}
+
+// referenceRoot 按定义逐层计算深度为 depth 的完整树的根哈希，用作对照
+// leaves 为 叶子槽位 -> 叶子哈希；空槽位的哈希为 H()，
+// 默认布局下空子树逐层合并，旧布局下任意高度的空子树都是 H()
+func referenceRoot(hasher Hasher, legacy bool, depth int, leaves map[int][]byte) []byte {
+	var node func(level, index int) ([]byte, bool)
+	node = func(level, index int) ([]byte, bool) {
+		if level == depth {
+			if h, ok := leaves[index]; ok {
+				return h, false
+			}
+			return hasher.Hash(), true
+		}
+		left, leftEmpty := node(level+1, 2*index)
+		right, rightEmpty := node(level+1, 2*index+1)
+		if legacy {
+			if leftEmpty && rightEmpty {
+				return hasher.Hash(), true
+			}
+			return hasher.Hash(left, right), false
+		}
+		return hasher.Hash([]byte{0x01}, left, right), leftEmpty && rightEmpty
+	}
+	root, _ := node(0, 0)
+	return root
+}
+
+// TestHashLayout 默认布局为 H(0x00||keyHash||H(value)) 和 H(0x01||L||R)，旧布局为 H(value) 和 H(L||R)
+func TestHashLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher Hasher
+		legacy bool
+	}{
+		{"default", SHA256Hasher, false},
+		{"legacy", SHA256Hasher, true},
+		{"default sha3", SHA3_256Hasher, false},
+		{"legacy sha3", SHA3_256Hasher, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithHasher(tt.hasher)}
+			if tt.legacy {
+				opts = append(opts, WithLegacyHashing())
+			}
+			tree := NewSparseMerkleTree(8, opts...)
+			leaves := make(map[int][]byte)
+			for i := 0; i < 10; i++ {
+				key, value := []byte(fmt.Sprintf("account%d", i)), []byte("same value")
+				keyHash := tt.hasher.Hash(key)
+				if _, taken := leaves[int(keyHash[0])]; taken {
+					continue // 深度为 8 时落在同一个槽位，会被拒绝
+				}
+				if err := tree.Update(key, value); err != nil {
+					t.Fatal(err)
+				}
+				if tt.legacy {
+					leaves[int(keyHash[0])] = tt.hasher.Hash(value)
+				} else {
+					leaves[int(keyHash[0])] = tt.hasher.Hash([]byte{0x00}, keyHash, tt.hasher.Hash(value))
+				}
+			}
+			if want := referenceRoot(tt.hasher, tt.legacy, 8, leaves); !bytes.Equal(tree.GetRoot(), want) {
+				t.Errorf("root %x, want %x", tree.GetRoot(), want)
+			}
+		})
+	}
+}
+
+// TestSecondPreimage 以两个子节点哈希拼接而成的 64 字节值作为叶子，默认布局下不能冒充它们的父节点
+func TestSecondPreimage(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		collide bool // 伪造的叶子哈希是否等于内部节点哈希
+	}{
+		{"default", nil, false},
+		{"legacy", []Option{WithLegacyHashing()}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTreeConfig(tt.opts)
+			left, right := c.hashData([]byte("left")), c.hashData([]byte("right"))
+			value := append(bytes.Clone(left), right...)
+			leaf := c.hashLeaf(c.hashKey([]byte("any key")), c.hashValue(value))
+			if got := bytes.Equal(leaf, c.hashNodes(left, right)); got != tt.collide {
+				t.Errorf("leaf hash equals node hash: got %v, want %v", got, tt.collide)
+			}
+		})
+	}
+}
+
+// TestLegacyForgedAbsence 旧布局的叶子哈希不绑定键：把键自己的叶子说成是另一个键的叶子，
+// 就能"证明"一个存在的键不存在，这样的证明必须被拒绝
+func TestLegacyForgedAbsence(t *testing.T) {
+	key, value := []byte("alice"), []byte("100")
+	tree := NewSparseMerkleTree(8, WithLegacyHashing())
+	if err := tree.Update(key, value); err != nil {
+		t.Fatal(err)
+	}
+	root := tree.GetRoot()
+	keyHash := tree.hashKey(key)
+	// 与 alice 处在同一个槽位（前 8 位相同）的另一个键哈希
+	forged := bytes.Clone(keyHash)
+	forged[len(forged)-1] ^= 0x01
+
+	// 合法的证明在旧布局下仍然有效
+	proof, err := tree.GenerateProof(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyProof(root, key, value, proof, WithLegacyHashing()) {
+		t.Fatal("inclusion proof does not verify")
+	}
+	absent, err := tree.GenerateProof([]byte("nobody"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if absent.LeafKey != nil || !VerifyNonInclusionProof(root, []byte("nobody"), absent, WithLegacyHashing()) {
+		t.Fatal("empty-slot non-inclusion proof does not verify")
+	}
+
+	t.Run("full depth", func(t *testing.T) {
+		// 深度等于键哈希的比特数时，叶子的位置约束了完整的键哈希，终点是其他叶子的证明仍然有效
+		full := NewSparseMerkleTree(256, WithLegacyHashing(), WithShortcutLeaves())
+		if err := full.Update(key, value); err != nil {
+			t.Fatal(err)
+		}
+		p, err := full.GenerateProof([]byte("nobody"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.LeafKey == nil || !VerifyNonInclusionProof(full.GetRoot(), []byte("nobody"), p, WithLegacyHashing(), WithShortcutLeaves()) {
+			t.Error("non-inclusion proof ending at a shortcut leaf does not verify")
+		}
+	})
+
+	t.Run("proof", func(t *testing.T) {
+		p := *proof
+		p.Exists = false
+		p.LeafKey = forged
+		p.LeafValueHash = tree.hashData(value)
+		if VerifyNonInclusionProof(root, key, &p, WithLegacyHashing()) {
+			t.Error("forged non-inclusion proof verifies")
+		}
+	})
+
+	t.Run("multiproof", func(t *testing.T) {
+		p, _, err := tree.GenerateMultiProof([][]byte{key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Leaves[0].Key = forged
+		if VerifyMultiProof(root, []ProofEntry{{Key: key}}, p, WithLegacyHashing()) {
+			t.Error("forged multiproof verifies")
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		p, leaves, err := tree.GenerateRangeProof(keyHash, keyHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(leaves) != 1 || !VerifyRangeProof(root, keyHash, keyHash, leaves, p, WithLegacyHashing()) {
+			t.Fatal("range proof does not verify")
+		}
+		for i := range p.Leaves {
+			if bytes.Equal(p.Leaves[i].Key, keyHash) {
+				p.Leaves[i].Key = forged // 把区间中的叶子移到区间之外
+			}
+		}
+		if VerifyRangeProof(root, keyHash, keyHash, nil, p, WithLegacyHashing()) {
+			t.Error("forged range proof hides a key in the range")
+		}
+	})
+}
+
+// TestVerifyProofStateless 只持有根哈希的验证者可以验证证明，证明不能被挪用到其他键、值或根
+func TestVerifyProofStateless(t *testing.T) {
+	tree := NewSparseMerkleTree(256)
+	for _, kv := range [][2]string{{"alice", "100"}, {"bob", "200"}, {"carol", "200"}} {
+		if err := tree.Update([]byte(kv[0]), []byte(kv[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := tree.GetRoot()
+	proof, err := tree.GenerateProof([]byte("bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewSparseMerkleTree(256)
+	if err := other.Update([]byte("bob"), []byte("200")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		root  []byte
+		key   string
+		value string
+		proof *Proof
+		opts  []Option
+		want  bool
+	}{
+		{"valid", root, "bob", "200", proof, nil, true},
+		{"key with the same value", root, "carol", "200", proof, nil, false},
+		{"wrong value", root, "bob", "201", proof, nil, false},
+		{"other root", other.GetRoot(), "bob", "200", proof, nil, false},
+		{"wrong hasher", root, "bob", "200", proof, []Option{WithHasher(SHA3_256Hasher)}, false},
+		{"nil proof", root, "bob", "200", nil, nil, false},
+		{"absence proof", root, "bob", "200", &Proof{Depth: 256, Exists: false}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyProof(tt.root, []byte(tt.key), []byte(tt.value), tt.proof, tt.opts...); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// 树上的便捷方法与包级函数一致，并额外检查深度
+	if !tree.VerifyProof([]byte("bob"), []byte("200"), proof) {
+		t.Error("method does not verify a valid proof")
+	}
+	if NewSparseMerkleTree(128).VerifyProof([]byte("bob"), []byte("200"), proof) {
+		t.Error("method verifies a proof for a different depth")
+	}
+}
+
+// TestDelete 删除后的根哈希与从未插入过该键的树一致，空出的内部节点被剪除
+func TestDelete(t *testing.T) {
+	modes := []struct {
+		name  string
+		depth int
+		opts  []Option
+	}{
+		{"default", 256, nil},
+		{"shortcut", 256, []Option{WithShortcutLeaves()}},
+		{"legacy", 256, []Option{WithLegacyHashing()}},
+		{"shallow", 32, nil},
+	}
+	tests := []struct {
+		name   string
+		delete []string
+		found  bool
+	}{
+		{"present", []string{"bob"}, true},
+		{"absent", []string{"dave"}, false},
+		{"twice", []string{"bob", "bob"}, false},
+		{"all", []string{"alice", "bob", "carol"}, true},
+	}
+	keys := []string{"alice", "bob", "carol"}
+	for _, m := range modes {
+		for _, tt := range tests {
+			t.Run(m.name+"/"+tt.name, func(t *testing.T) {
+				tree := NewSparseMerkleTree(m.depth, m.opts...)
+				for _, k := range keys {
+					if err := tree.Update([]byte(k), []byte(k+"-value")); err != nil {
+						t.Fatal(err)
+					}
+				}
+				var found bool
+				for _, k := range tt.delete {
+					var err error
+					if found, err = tree.Delete([]byte(k)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if found != tt.found {
+					t.Errorf("last Delete: got %v, want %v", found, tt.found)
+				}
+
+				// 只插入剩下的键得到的树
+				want := NewSparseMerkleTree(m.depth, m.opts...)
+				for _, k := range keys {
+					if !slices.Contains(tt.delete, k) {
+						if err := want.Update([]byte(k), []byte(k+"-value")); err != nil {
+							t.Fatal(err)
+						}
+					}
+				}
+				if !bytes.Equal(tree.GetRoot(), want.GetRoot()) {
+					t.Errorf("root %x, want %x", tree.GetRoot(), want.GetRoot())
+				}
+				if got := countNodes(tree.root); got != countNodes(want.root) {
+					t.Errorf("%d nodes, want %d", got, countNodes(want.root))
+				}
+			})
+		}
+	}
+}
+
+// countNodes 统计内存中子树的节点数
+func countNodes(node *Node) int {
+	if node == nil {
+		return 0
+	}
+	return 1 + countNodes(node.left) + countNodes(node.right)
+}
+
+// TestDeleteDiffersFromEmptyValue 写入空值会留下叶子，与删除不同
+func TestDeleteDiffersFromEmptyValue(t *testing.T) {
+	deleted, empty := NewSparseMerkleTree(256), NewSparseMerkleTree(256)
+	for _, tree := range []*SparseMerkleTree{deleted, empty} {
+		if err := tree.Update([]byte("alice"), []byte("100")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := deleted.Delete([]byte("alice")); err != nil {
+		t.Fatal(err)
+	}
+	if err := empty.Update([]byte("alice"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(deleted.GetRoot(), empty.GetRoot()) {
+		t.Error("writing an empty value gives the same root as deleting")
+	}
+	if _, found, _ := empty.Get([]byte("alice")); !found {
+		t.Error("key with an empty value not found")
+	}
+}
+
+// TestNonInclusionProof 不存在性证明只对证明中的键和生成时的根有效，不能与存在性证明互换
+func TestNonInclusionProof(t *testing.T) {
+	modes := []struct {
+		name  string
+		depth int
+		opts  []Option
+	}{
+		{"default", 256, nil},
+		{"shortcut", 256, []Option{WithShortcutLeaves()}},
+		{"shallow", 8, nil},
+	}
+	for _, m := range modes {
+		t.Run(m.name, func(t *testing.T) {
+			tree := NewSparseMerkleTree(m.depth, m.opts...)
+			for _, k := range []string{"alice", "bob", "carol"} {
+				if err := tree.Update([]byte(k), []byte(k+"-value")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			root := tree.GetRoot()
+			absence, err := tree.GenerateProof([]byte("dave"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if absence.Exists {
+				t.Fatal("proof for a missing key claims it exists")
+			}
+			inclusion, err := tree.GenerateProof([]byte("alice"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			later := NewSparseMerkleTree(m.depth, m.opts...)
+			for _, k := range []string{"alice", "bob", "carol", "dave"} {
+				if err := later.Update([]byte(k), []byte(k+"-value")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tests := []struct {
+				name  string
+				root  []byte
+				key   string
+				proof *Proof
+				want  bool
+			}{
+				{"valid", root, "dave", absence, true},
+				{"present key", root, "alice", absence, false},
+				{"inclusion proof", root, "alice", inclusion, false},
+				{"root after insert", later.GetRoot(), "dave", absence, false},
+				{"nil proof", root, "dave", nil, false},
+			}
+			for _, tt := range tests {
+				if got := VerifyNonInclusionProof(tt.root, []byte(tt.key), tt.proof, m.opts...); got != tt.want {
+					t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				}
+			}
+			if !tree.VerifyNonInclusionProof([]byte("dave"), absence) {
+				t.Error("method does not verify a valid proof")
+			}
+			// 不存在性证明不能当作存在性证明使用
+			if VerifyProof(root, []byte("dave"), nil, absence, m.opts...) {
+				t.Error("absence proof verifies as inclusion")
+			}
+		})
+	}
+}